@@ -109,6 +109,28 @@ func validateResult(t *testing.T, err error, output []byte, expectedErrors []str
 	}
 }
 
+func validateFiles(t *testing.T, err error, files map[string][]byte, evaluate *bkl.DocEvaluate) {
+	validateError(t, err, evaluate.Errors)
+	if err != nil {
+		return
+	}
+
+	for _, expected := range evaluate.Outputs {
+		output, found := files[expected.Filename]
+		if !found {
+			t.Errorf("Missing output file %s", expected.Filename)
+			continue
+		}
+
+		validateOutput(t, output, expected.Code, 0)
+		delete(files, expected.Filename)
+	}
+
+	for path := range files {
+		t.Errorf("Unexpected output file %s", path)
+	}
+}
+
 func runEvaluateTest(t *testing.T, evaluate *bkl.DocEvaluate) {
 	fsys := fstest.MapFS{}
 	rootPath := setupRootPath(evaluate.Root)
@@ -130,7 +152,42 @@ func runEvaluateTest(t *testing.T, evaluate *bkl.DocEvaluate) {
 	format := getFormat(evaluate.Result.Languages)
 	firstFile := getFirstFile(evalFiles)
 
-	output, err := bkl.Evaluate(testFS, evalFiles, rootPath, rootPath, evaluate.Env, format, evaluate.Sort, firstFile)
+	opts := &bkl.Options{Format: evaluate.Options}
+
+	var output []byte
+	var err error
+
+	switch {
+	case evaluate.OutputDir:
+		results, err := bkl.EvaluateFiles(testFS, evalFiles, rootPath, rootPath, evaluate.Env, format, opts, evaluate.FileTemplate, evaluate.Sort, firstFile)
+
+		files := map[string][]byte{}
+		for _, result := range results {
+			files[result.Path] = result.Output
+		}
+
+		validateFiles(t, err, files, evaluate)
+		return
+	case evaluate.InferSchema:
+		output, err = bkl.InferSchema(testFS, "/", "", evaluate.Env, format, opts)
+
+		// The schema of the files that evaluated comes with the errors of
+		// those that didn't
+		if err != nil {
+			validateError(t, err, evaluate.Errors)
+			validateOutput(t, output, evaluate.Result.Code, 0)
+			return
+		}
+	case evaluate.Stream:
+		buf := &bytes.Buffer{}
+		err = bkl.EvaluateStream(testFS, evalFiles, rootPath, rootPath, evaluate.Env, format, opts, buf, firstFile)
+		output = buf.Bytes()
+	case evaluate.Query != "":
+		output, err = bkl.Query(testFS, evalFiles, rootPath, rootPath, evaluate.Env, evaluate.Query, format, opts, evaluate.Sort, firstFile)
+	default:
+		output, err = bkl.EvaluateWithOptions(testFS, evalFiles, rootPath, rootPath, evaluate.Env, format, opts, evaluate.Sort, firstFile)
+	}
+
 	validateResult(t, err, output, evaluate.Errors, evaluate.Result.Code, 0)
 }
 
@@ -172,10 +229,20 @@ func runDiffTest(t *testing.T, diff *bkl.DocDiff) {
 		Data: []byte(diff.Target.Code),
 	}
 
+	basePaths := []string{diff.Base.Filename}
+
+	for _, base := range diff.Bases {
+		fsys[base.Filename] = &fstest.MapFile{
+			Data: []byte(base.Code),
+		}
+
+		basePaths = append(basePaths, base.Filename)
+	}
+
 	format := getFormat(diff.Result.Languages)
 	firstFile := &diff.Base.Filename
 
-	output, err := bkl.Diff(fsys, diff.Base.Filename, diff.Target.Filename, rootPath, rootPath, diff.Selector, format, firstFile)
+	output, err := bkl.DiffBases(fsys, basePaths, diff.Target.Filename, rootPath, rootPath, diff.Selector, format, &bkl.Options{RedactPaths: diff.Redact}, firstFile)
 	validateResult(t, err, output, diff.Errors, diff.Result.Code, 0)
 }
 
@@ -192,12 +259,32 @@ func runCompareTest(t *testing.T, compare *bkl.DocCompare) {
 
 	format := getFormat(compare.Result.Languages)
 
-	result, err := bkl.Compare(fsys, compare.Left.Filename, compare.Right.Filename, rootPath, rootPath, compare.Env, format, compare.Sort)
+	result, err := bkl.CompareWithOptions(fsys, compare.Left.Filename, compare.Right.Filename, rootPath, rootPath, compare.Env, format, &bkl.Options{
+		RedactPaths: compare.Redact,
+		Selectors:   compare.Selector,
+	}, compare.Sort)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	validateOutput(t, []byte(result.Diff), compare.Result.Code, 2)
+	switch compare.Changes {
+	case "":
+		validateOutput(t, []byte(result.Diff), compare.Result.Code, 2)
+
+	case "json":
+		output, err := bkl.CompareJSON(result.Changes)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		validateOutput(t, output, compare.Result.Code, 0)
+
+	case "markdown":
+		validateOutput(t, []byte(bkl.CompareMarkdown(result.Changes)), compare.Result.Code, 0)
+
+	default:
+		validateOutput(t, []byte(bkl.CompareText(result.Changes)), compare.Result.Code, 0)
+	}
 }
 
 func runConvertTest(t *testing.T, convert *bkl.DocConvert) {
@@ -242,6 +329,110 @@ func runFixitTest(t *testing.T, fixit *bkl.DocFixit) {
 	validateResult(t, err, output, nil, expectedOutput, 0)
 }
 
+func runFormatTest(t *testing.T, format *bkl.DocFormat) {
+	fsys := fstest.MapFS{}
+	rootPath := "/"
+
+	fsys[format.Input.Filename] = &fstest.MapFile{
+		Data: []byte(format.Input.Code),
+	}
+
+	output, err := bkl.FormatFile(fsys, format.Input.Filename, rootPath, rootPath)
+	validateResult(t, err, output, format.Errors, format.Result.Code, 0)
+
+	if err != nil {
+		return
+	}
+
+	again, err := bkl.FormatFile(fstest.MapFS{format.Input.Filename: &fstest.MapFile{Data: output}}, format.Input.Filename, rootPath, rootPath)
+	if err != nil {
+		t.Fatalf("Unexpected error formatting output: %v", err)
+	}
+
+	if !bytes.Equal(again, output) {
+		t.Errorf("Formatting isn't idempotent\nFirst:\n%s\nSecond:\n%s", output, again)
+	}
+}
+
+func runLintTest(t *testing.T, lint *bkl.DocLint) {
+	fsys := fstest.MapFS{}
+
+	for _, input := range lint.Inputs {
+		fsys[input.Filename] = &fstest.MapFile{
+			Data: []byte(input.Code),
+		}
+	}
+
+	env := lint.Env
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	issues, err := bkl.Lint(fsys, "/", lint.Pattern, env)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := []byte(bkl.LintText(issues))
+
+	if lint.SARIF {
+		output, err = bkl.LintSARIF(issues)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	validateOutput(t, output, lint.Result.Code, 0)
+}
+
+func runRefactorTest(t *testing.T, refactor *bkl.DocRefactor) {
+	fsys := fstest.MapFS{}
+	paths := []string{}
+
+	for _, input := range refactor.Inputs {
+		fsys[input.Filename] = &fstest.MapFile{
+			Data: []byte(input.Code),
+		}
+
+		paths = append(paths, input.Filename)
+	}
+
+	files, err := bkl.Refactor(fsys, paths, refactor.Into, "/", "/", refactor.Selector)
+	validateError(t, err, refactor.Errors)
+
+	if err != nil {
+		return
+	}
+
+	outputs := map[string][]byte{}
+	for _, f := range files {
+		outputs[f.Path] = f.Content
+	}
+
+	validateFiles(t, nil, outputs, &bkl.DocEvaluate{Outputs: refactor.Outputs})
+}
+
+func runEncryptTest(t *testing.T, encrypt *bkl.DocEncrypt) {
+	fsys := fstest.MapFS{}
+
+	evalFiles := addInputFiles(fsys, encrypt.Inputs)
+	path := evalFiles[len(evalFiles)-1]
+
+	enc, err := bkl.Encrypt(fsys, path, "/", "/", encrypt.Path, "age", nil, encrypt.Env)
+	validateError(t, err, encrypt.Errors)
+
+	if err != nil {
+		return
+	}
+
+	fsys[path] = &fstest.MapFile{
+		Data: enc,
+	}
+
+	output, err := bkl.Evaluate(fsys, []string{path}, "/", "/", encrypt.Env, nil, nil, &path)
+	validateResult(t, err, output, nil, encrypt.Result.Code, 0)
+}
+
 func RunTestLoop(t *testing.T, tests map[string]*bkl.DocExample) {
 	for testName, testCase := range tests {
 		if testCase.Benchmark {
@@ -265,6 +456,14 @@ func RunTestLoop(t *testing.T, tests map[string]*bkl.DocExample) {
 				runConvertTest(t, testCase.Convert)
 			case testCase.Fixit != nil:
 				runFixitTest(t, testCase.Fixit)
+			case testCase.Format != nil:
+				runFormatTest(t, testCase.Format)
+			case testCase.Lint != nil:
+				runLintTest(t, testCase.Lint)
+			case testCase.Refactor != nil:
+				runRefactorTest(t, testCase.Refactor)
+			case testCase.Encrypt != nil:
+				runEncryptTest(t, testCase.Encrypt)
 			}
 		})
 	}
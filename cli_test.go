@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -62,6 +63,64 @@ func addSortArgs(args []string, sortPaths []string) []string {
 	return args
 }
 
+func addRedactArgs(args []string, paths []string) []string {
+	for _, path := range paths {
+		args = append(args, "--redact", path)
+	}
+	return args
+}
+
+func addFormatOptionArgs(args []string, opts *bkl.FormatOptions) []string {
+	if opts == nil {
+		return args
+	}
+	if opts.Indent != 0 {
+		args = append(args, "--indent", strconv.Itoa(opts.Indent))
+	}
+	if opts.CompactSequences {
+		args = append(args, "--compact-sequences")
+	}
+	if opts.Quote != "" {
+		args = append(args, "--quote", opts.Quote)
+	}
+	if opts.LineWidth != 0 {
+		args = append(args, "--line-width", strconv.Itoa(opts.LineWidth))
+	}
+	if opts.Literal {
+		args = append(args, "--literal")
+	}
+	if opts.NoFinalNewline {
+		args = append(args, "--no-final-newline")
+	}
+	if opts.PreserveTags {
+		args = append(args, "--preserve-tags")
+	}
+	return args
+}
+
+func readCLIOutputDir(t *testing.T, dir string) map[string][]byte {
+	files := map[string][]byte{}
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == ".bkl-files" {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files[rel], err = os.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to read output directory: %v", err)
+	}
+
+	return files
+}
+
 func executeCLICommand(t *testing.T, cmdPath string, args []string, env map[string]string, expectedErrors []string) []byte {
 	cmdArgs := append([]string{"run", cmdPath}, args...)
 	cmd := exec.Command("go", cmdArgs...)
@@ -128,6 +187,12 @@ func TestCLI(t *testing.T) {
 				runTestCLIDiff(t, testCase)
 			case testCase.Compare != nil:
 				runTestCLICompare(t, testCase)
+			case testCase.Format != nil:
+				runTestCLIFormat(t, testCase)
+			case testCase.Lint != nil:
+				runTestCLILint(t, testCase)
+			case testCase.Refactor != nil:
+				runTestCLIRefactor(t, testCase)
 			}
 		})
 	}
@@ -144,7 +209,9 @@ func runTestCLIEvaluate(t *testing.T, testCase *bkl.DocExample) {
 	var args []string
 	args = addRootPathArg(args, tmpDir, testCase.Evaluate.Root)
 
-	if len(testCase.Evaluate.Inputs) > 0 {
+	if testCase.Evaluate.InferSchema {
+		args = append(args, "--infer-schema", tmpDir)
+	} else if len(testCase.Evaluate.Inputs) > 0 {
 		lastInput := testCase.Evaluate.Inputs[len(testCase.Evaluate.Inputs)-1]
 		args = append(args, filepath.Join(tmpDir, lastInput.Filename))
 	}
@@ -152,6 +219,31 @@ func runTestCLIEvaluate(t *testing.T, testCase *bkl.DocExample) {
 	args = addFormatArg(args, testCase.Evaluate.Result.Languages)
 	args = addSortArgs(args, testCase.Evaluate.Sort)
 
+	if testCase.Evaluate.Query != "" {
+		args = append(args, "--query", testCase.Evaluate.Query)
+	}
+
+	if testCase.Evaluate.Stream {
+		args = append(args, "--stream")
+	}
+
+	args = addFormatOptionArgs(args, testCase.Evaluate.Options)
+
+	if testCase.Evaluate.OutputDir {
+		outDir := filepath.Join(tmpDir, "out")
+		args = append(args, "--output-dir", outDir)
+
+		if testCase.Evaluate.FileTemplate != "" {
+			args = append(args, "--file-template", testCase.Evaluate.FileTemplate)
+		}
+
+		executeCLICommand(t, "./cmd/bkl", args, testCase.Evaluate.Env, testCase.Evaluate.Errors)
+		if len(testCase.Evaluate.Errors) == 0 {
+			validateFiles(t, nil, readCLIOutputDir(t, outDir), testCase.Evaluate)
+		}
+		return
+	}
+
 	output := executeCLICommand(t, "./cmd/bkl", args, testCase.Evaluate.Env, testCase.Evaluate.Errors)
 	if output != nil {
 		validateOutput(t, output, testCase.Evaluate.Result.Code, 0)
@@ -214,15 +306,25 @@ func runTestCLIDiff(t *testing.T, testCase *bkl.DocExample) {
 		testCase.Diff.Target.Filename: testCase.Diff.Target.Code,
 	}
 
+	for _, base := range testCase.Diff.Bases {
+		files[base.Filename] = base.Code
+	}
+
 	tmpDir := setupCLITestFiles(t, files)
 
 	var args []string
 
 	args = append(args, filepath.Join(tmpDir, testCase.Diff.Base.Filename))
+
+	for _, base := range testCase.Diff.Bases {
+		args = append(args, filepath.Join(tmpDir, base.Filename))
+	}
+
 	args = append(args, filepath.Join(tmpDir, testCase.Diff.Target.Filename))
 
 	args = addFormatArg(args, testCase.Diff.Result.Languages)
 	args = addSelectorArgs(args, testCase.Diff.Selector)
+	args = addRedactArgs(args, testCase.Diff.Redact)
 
 	output := executeCLICommand(t, "./cmd/bkld", args, nil, testCase.Diff.Errors)
 	if output != nil {
@@ -245,9 +347,139 @@ func runTestCLICompare(t *testing.T, testCase *bkl.DocExample) {
 
 	args = addFormatArg(args, testCase.Compare.Result.Languages)
 	args = addSortArgs(args, testCase.Compare.Sort)
+	args = addRedactArgs(args, testCase.Compare.Redact)
+
+	for _, selector := range testCase.Compare.Selector {
+		args = append(args, "--selector", selector)
+	}
+
+	skipLines := 2
+	if testCase.Compare.Changes != "" {
+		args = append(args, "--changes="+testCase.Compare.Changes)
+		skipLines = 0
+	}
 
 	output := executeCLICommand(t, "./cmd/bklc", args, testCase.Compare.Env, nil)
 	if output != nil {
-		validateOutput(t, output, testCase.Compare.Result.Code, 2)
+		validateOutput(t, output, testCase.Compare.Result.Code, skipLines)
+	}
+}
+
+func runTestCLIFormat(t *testing.T, testCase *bkl.DocExample) {
+	format := testCase.Format
+	tmpDir := setupCLITestFiles(t, map[string]string{
+		format.Input.Filename: format.Input.Code,
+	})
+
+	path := filepath.Join(tmpDir, format.Input.Filename)
+
+	if len(format.Errors) > 0 {
+		executeCLICommand(t, "./cmd/bkl", []string{"fmt", path}, nil, format.Errors)
+		return
+	}
+
+	if strings.TrimSpace(format.Input.Code) != strings.TrimSpace(format.Result.Code) {
+		executeCLICommand(t, "./cmd/bkl", []string{"fmt", "--check", path}, nil, []string{format.Input.Filename})
+	}
+
+	executeCLICommand(t, "./cmd/bkl", []string{"fmt", path}, nil, nil)
+
+	output, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read formatted file: %v", err)
+	}
+
+	validateOutput(t, output, format.Result.Code, 0)
+
+	executeCLICommand(t, "./cmd/bkl", []string{"fmt", "--check", path}, nil, nil)
+}
+
+func runTestCLILint(t *testing.T, testCase *bkl.DocExample) {
+	lint := testCase.Lint
+
+	files := map[string]string{}
+	for _, input := range lint.Inputs {
+		files[input.Filename] = input.Code
+	}
+
+	tmpDir := setupCLITestFiles(t, files)
+
+	args := []string{"run", "./cmd/bkl", "lint", tmpDir}
+
+	if lint.Pattern != "" {
+		args = append(args, "--pattern", lint.Pattern)
+	}
+
+	if lint.SARIF {
+		args = append(args, "--format", "sarif")
+	}
+
+	cmd := exec.Command("go", args...)
+	cmd.Env = os.Environ()
+
+	for k, v := range lint.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	output, err := cmd.Output()
+
+	clean := strings.TrimSpace(lint.Result.Code) == "" || strings.Contains(lint.Result.Code, `"results": []`)
+
+	if clean {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v\nOutput: %s", err, output)
+		}
+	} else if err == nil {
+		t.Fatalf("Expected exit status 1 for lint issues\nOutput: %s", output)
+	}
+
+	output = []byte(strings.ReplaceAll(string(output), tmpDir+"/", ""))
+
+	validateOutput(t, output, lint.Result.Code, 0)
+}
+
+func runTestCLIRefactor(t *testing.T, testCase *bkl.DocExample) {
+	refactor := testCase.Refactor
+
+	files := map[string]string{}
+	for _, input := range refactor.Inputs {
+		files[input.Filename] = input.Code
+	}
+
+	tmpDir := setupCLITestFiles(t, files)
+
+	args := []string{"refactor", "--into", filepath.Join(tmpDir, refactor.Into)}
+
+	for _, selector := range refactor.Selector {
+		args = append(args, "--selector", selector)
+	}
+
+	for _, input := range refactor.Inputs {
+		args = append(args, filepath.Join(tmpDir, input.Filename))
+	}
+
+	executeCLICommand(t, "./cmd/bkl", args, nil, refactor.Errors)
+
+	if len(refactor.Errors) > 0 {
+		// Nothing is written if the refactored files don't check out
+		for _, input := range refactor.Inputs {
+			output, err := os.ReadFile(filepath.Join(tmpDir, input.Filename))
+			if err != nil {
+				t.Fatalf("Failed to read input file: %v", err)
+			}
+
+			validateOutput(t, output, input.Code, 0)
+		}
+
+		return
+	}
+
+	for _, expected := range refactor.Outputs {
+		output, err := os.ReadFile(filepath.Join(tmpDir, expected.Filename))
+		if err != nil {
+			t.Fatalf("Failed to read refactored file: %v", err)
+		}
+
+		validateOutput(t, output, expected.Code, 0)
 	}
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/pathutil"
+)
+
+var directives = []struct {
+	name string
+	desc string
+}{
+	{"$parent", "Parent layer(s) to inherit from, instead of the filename; false for none."},
+	{"$match", "Select the parent document or list entry to merge into."},
+	{"$output", "Output only this subtree; false hides it from output."},
+	{"$merge", "Merge in the value at a path."},
+	{"$replace", "Replace with the value at a path, or true to replace the parent's value."},
+	{"$delete", "Delete from the parent: a key's value, or list entries."},
+	{"$insertBefore", "Insert list entries before the entry matching this."},
+	{"$insertAfter", "Insert list entries after the entry matching this."},
+	{"$encode", "Encode the value: json, yaml, base64, etc."},
+	{"$decode", "Decode $value: json, yaml, base64, age, pgp, etc."},
+	{"$value", "The value for $encode, $decode and similar directives."},
+	{"$repeat", "Repeat the document or list entry for each value."},
+	{"$defer", "Apply this document after all others."},
+	{"$file", "Write this output document to a separate file."},
+	{"$sensitive", "Redact this value from diffs and MCP responses."},
+	{"$required", "Must be overridden by a child layer before output."},
+	{"$env:", "The value of an environment variable."},
+	{`$""`, "Interpolate {path} references into a string."},
+}
+
+func directiveDescription(name string) (string, bool) {
+	for _, d := range directives {
+		if d.name == name {
+			return d.desc, true
+		}
+	}
+
+	return "", false
+}
+
+// completion offers directives and the keys that parent layers set at the
+// map enclosing pos.
+func (s *server) completion(path string, pos position) ([]completionItem, error) {
+	text, err := s.text(path)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []completionItem{}
+
+	for _, d := range directives {
+		items = append(items, completionItem{
+			Label:  d.name,
+			Kind:   completionKindKeyword,
+			Detail: d.desc,
+		})
+	}
+
+	line := lineAt(text, pos.Line)
+
+	word := strings.TrimLeft(line[:min(pos.Character, len(line))], " -")
+	if strings.HasPrefix(word, "$") {
+		return items, nil
+	}
+
+	parts, ok := indentPath(text, pos)
+	if !ok {
+		return items, nil
+	}
+
+	keys := map[string]string{}
+	layers := s.layers(path)
+
+	for _, l := range layers[1:] {
+		for _, doc := range l.data {
+			v, err := pathutil.Get(doc, parts)
+			if err != nil {
+				continue
+			}
+
+			m, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			for k := range m {
+				if _, found := keys[k]; found || strings.HasPrefix(k, "$") {
+					continue
+				}
+
+				keys[k] = relPath(path, l.path)
+			}
+		}
+	}
+
+	names := []string{}
+	for k := range keys {
+		names = append(names, k)
+	}
+
+	sort.Strings(names)
+
+	for _, k := range names {
+		items = append(items, completionItem{
+			Label:  k,
+			Kind:   completionKindProperty,
+			Detail: fmt.Sprintf("from %s", keys[k]),
+		})
+	}
+
+	return items, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/pathutil"
+)
+
+// definition resolves, at pos:
+//   - a $parent value to the parent files
+//   - a $merge or $replace value, or a $"{...}" reference, to where that
+//     path is set
+//   - any other key to the same key in the nearest parent layer, or to the
+//     parent files if none has it
+func (s *server) definition(path string, pos position) ([]location, error) {
+	layers := s.layers(path)
+
+	text, err := s.text(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref, found := interpolationAt(lineAt(text, pos.Line), pos.Character); found {
+		if strings.HasPrefix(ref, "$") {
+			return []location{}, nil
+		}
+
+		return findPath(layers, pathutil.SplitPath(ref)), nil
+	}
+
+	c := nodeAt(layers[0].nodes, pos)
+	if c == nil || len(c.path) == 0 {
+		return []location{}, nil
+	}
+
+	switch {
+	case c.path[0] == "$parent" && !c.onKey:
+		return s.parentFiles(path, c.node.Value)
+
+	case !c.onKey && (c.path[len(c.path)-1] == "$merge" || c.path[len(c.path)-1] == "$replace"):
+		return findPath(layers, pathutil.SplitPath(c.node.Value)), nil
+
+	case c.onKey && !strings.HasPrefix(c.node.Value, "$"):
+		locs := findPath(layers[1:], c.path)
+		if len(locs) > 0 {
+			return locs, nil
+		}
+
+		ret := []location{}
+
+		for _, l := range layers[1:] {
+			ret = append(ret, location{URI: pathToURI(l.path)})
+		}
+
+		return ret, nil
+	}
+
+	return []location{}, nil
+}
+
+// parentFiles returns the files that a $parent value names, relative to path.
+func (s *server) parentFiles(path string, parent string) ([]location, error) {
+	matches, err := fsys.New(s.fsys).GlobFiles(filepath.Join(filepath.Dir(path), parent))
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []location{}
+
+	for _, match := range matches {
+		ret = append(ret, location{URI: pathToURI(match)})
+	}
+
+	return ret, nil
+}
+
+// findPath returns where parts is set in the first layer that has it.
+func findPath(layers []*layer, parts []string) []location {
+	for _, l := range layers {
+		if node := l.find(parts); node != nil {
+			return []location{{
+				URI:   pathToURI(l.path),
+				Range: nodeRange(node),
+			}}
+		}
+
+		for _, doc := range l.data {
+			if _, err := pathutil.Get(doc, parts); err == nil {
+				return []location{{URI: pathToURI(l.path)}}
+			}
+		}
+	}
+
+	return []location{}
+}
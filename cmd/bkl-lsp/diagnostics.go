@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gopatchy/bkl"
+)
+
+var (
+	lineRE = regexp.MustCompile(`\bline (\d+)\b`)
+	listRE = regexp.MustCompile(`^\[(.+)\]$`)
+)
+
+// diagnostics evaluates path and returns its error, if any, positioned as
+// well as the message allows.
+func (s *server) diagnostics(path string) []diagnostic {
+	_, err := bkl.Evaluate(s.fsys, []string{path}, "/", filepath.Dir(path), nil, nil, nil, &path)
+	if err != nil {
+		text, _ := s.text(path)
+		msg := err.Error()
+
+		return []diagnostic{{
+			Range:    locate(path, text, msg),
+			Severity: severityError,
+			Source:   "bkl",
+			Message:  msg,
+		}}
+	}
+
+	return []diagnostic{}
+}
+
+// locate finds where in text an error message points: a "line N" from the
+// parser, or else the first part of the message that appears in the text
+// (a key, directive, reference or parent name). Errors from other files go
+// at the start.
+func locate(path string, text string, msg string) lspRange {
+	zero := lspRange{}
+
+	first, _, _ := strings.Cut(msg, ": ")
+
+	switch {
+	case first == path:
+		m := lineRE.FindStringSubmatch(msg)
+		if m != nil {
+			line, _ := strconv.Atoi(m[1])
+			return lineRange(text, line-1)
+		}
+
+	case filepath.IsAbs(first) && filepath.Ext(first) != "":
+		return zero
+	}
+
+	for _, part := range strings.Split(msg, ": ") {
+		if strings.HasSuffix(part, "(bkl error)") {
+			break
+		}
+
+		candidates := []string{part}
+
+		if m := listRE.FindStringSubmatch(part); m != nil {
+			candidates = append(candidates, strings.ReplaceAll(m[1], " ", "."))
+		}
+
+		if filepath.IsAbs(part) {
+			candidates = append(candidates, filepath.Base(part))
+		}
+
+		for _, c := range candidates {
+			if c == "" {
+				continue
+			}
+
+			r, found := find(text, c)
+			if found {
+				return r
+			}
+		}
+	}
+
+	return zero
+}
+
+func lineRange(text string, line int) lspRange {
+	return lspRange{
+		Start: position{Line: line},
+		End:   position{Line: line, Character: len(lineAt(text, line))},
+	}
+}
+
+func find(text string, s string) (lspRange, bool) {
+	for i, line := range strings.Split(text, "\n") {
+		col := strings.Index(line, s)
+		if col >= 0 {
+			return lspRange{
+				Start: position{Line: i, Character: col},
+				End:   position{Line: i, Character: col + len(s)},
+			}, true
+		}
+	}
+
+	return lspRange{}, false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/pathutil"
+)
+
+// hover shows a directive's description, or a key's merged value and the
+// layers that set it.
+func (s *server) hover(path string, pos position) (*hover, error) {
+	layers := s.layers(path)
+
+	c := nodeAt(layers[0].nodes, pos)
+	if c == nil || len(c.path) == 0 {
+		return nil, nil
+	}
+
+	r := nodeRange(c.node)
+
+	if c.onKey {
+		if desc, found := directiveDescription(c.node.Value); found {
+			return &hover{
+				Contents: markupContent{Kind: "markdown", Value: fmt.Sprintf("**%s**\n\n%s", c.node.Value, desc)},
+				Range:    &r,
+			}, nil
+		}
+	}
+
+	for _, part := range c.path {
+		if strings.HasPrefix(part, "$") {
+			return nil, nil
+		}
+	}
+
+	b := &strings.Builder{}
+
+	value, err := s.mergedValue(path, c.path)
+	if err != nil {
+		fmt.Fprintf(b, "Merged value unavailable: %s\n\n", err)
+	} else if value != "" {
+		fmt.Fprintf(b, "```yaml\n%s```\n\n", value)
+	} else {
+		fmt.Fprintf(b, "Not in output\n\n")
+	}
+
+	set := []string{}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		l := layers[i]
+
+		if node := l.find(c.path); node != nil {
+			set = append(set, fmt.Sprintf("- `%s:%d`", relPath(path, l.path), node.Line))
+			continue
+		}
+
+		for _, doc := range l.data {
+			if _, err := pathutil.Get(doc, c.path); err == nil {
+				set = append(set, fmt.Sprintf("- `%s`", relPath(path, l.path)))
+				break
+			}
+		}
+	}
+
+	if len(set) > 0 {
+		fmt.Fprintf(b, "Set in:\n%s\n", strings.Join(set, "\n"))
+	}
+
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: b.String()},
+		Range:    &r,
+	}, nil
+}
+
+// mergedValue returns the value at parts in each output document of path,
+// as YAML, or "" if no output has it.
+func (s *server) mergedValue(path string, parts []string) (string, error) {
+	outputs, err := merge.Outputs(s.fsys, []string{path}, getOSEnv(), nil, nil, true)
+	if err != nil {
+		return "", err
+	}
+
+	values := []any{}
+
+	for _, out := range outputs {
+		v, err := pathutil.Get(out, parts)
+		if err == nil {
+			values = append(values, v)
+		}
+	}
+
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	ft, err := format.Get("yaml")
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ft.MarshalStream(values)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/gopatchy/bkl/internal/file"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/utils"
+)
+
+// layer is one file in the inheritance chain of a document.
+type layer struct {
+	path string
+	// Parsed with positions; only for YAML and JSON.
+	nodes []*yaml.Node
+	// Loaded document data, with $parent removed.
+	data []any
+}
+
+var interpolationRE = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// layers returns path and its parents, child first. If the parents can't be
+// loaded, it returns just path.
+func (s *server) layers(path string) []*layer {
+	files, err := file.LoadAndParents(fsys.New(s.fsys), path, nil, getOSEnv(), nil)
+	if err != nil {
+		files = nil
+	}
+
+	ret := []*layer{}
+	seen := map[string]bool{}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		f := files[i]
+
+		if seen[f.Path] {
+			continue
+		}
+
+		seen[f.Path] = true
+
+		l := &layer{path: f.Path}
+
+		for _, doc := range f.Docs {
+			l.data = append(l.data, doc.Data)
+		}
+
+		text, err := s.text(f.Path)
+		if err == nil {
+			l.nodes = parseNodes(f.Path, text)
+		}
+
+		ret = append(ret, l)
+	}
+
+	if len(ret) == 0 {
+		text, _ := s.text(path)
+		ret = append(ret, &layer{
+			path:  path,
+			nodes: parseNodes(path, text),
+		})
+	}
+
+	return ret
+}
+
+// parseNodes returns the documents of a YAML or JSON file, stopping at the
+// first one that doesn't parse.
+func parseNodes(path string, text string) []*yaml.Node {
+	switch utils.Ext(path) {
+	case "yaml", "yml", "json":
+	default:
+		return nil
+	}
+
+	docs := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(text)))
+
+	for {
+		node := &yaml.Node{}
+
+		err := dec.Decode(node)
+		if err == io.EOF || err != nil {
+			break
+		}
+
+		if len(node.Content) == 0 {
+			continue
+		}
+
+		docs = append(docs, node.Content[0])
+	}
+
+	return docs
+}
+
+// find returns the first node at parts in any of the layer's documents.
+func (l *layer) find(parts []string) *yaml.Node {
+	for _, doc := range l.nodes {
+		node := findNode(doc, parts)
+		if node != nil {
+			return node
+		}
+	}
+
+	return nil
+}
+
+func findNode(node *yaml.Node, parts []string) *yaml.Node {
+	if len(parts) == 0 {
+		return node
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == parts[0] {
+				// Return the key, so locations point at it.
+				if len(parts) == 1 {
+					return node.Content[i]
+				}
+
+				return findNode(node.Content[i+1], parts[1:])
+			}
+		}
+
+	case yaml.SequenceNode:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil
+		}
+
+		if idx < 0 {
+			idx += len(node.Content)
+		}
+
+		if idx >= 0 && idx < len(node.Content) {
+			return findNode(node.Content[idx], parts[1:])
+		}
+	}
+
+	return nil
+}
+
+// cursor is what's under a position in a document.
+type cursor struct {
+	path  []string
+	node  *yaml.Node
+	onKey bool
+}
+
+// nodeAt returns the key or scalar value at the 0-based pos, or nil.
+func nodeAt(docs []*yaml.Node, pos position) *cursor {
+	for _, doc := range docs {
+		c := nodeAtInt(doc, pos, []string{})
+		if c != nil {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func nodeAtInt(node *yaml.Node, pos position, path []string) *cursor {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			path2 := append(append([]string{}, path...), k.Value)
+
+			if contains(k, pos) {
+				return &cursor{path: path2, node: k, onKey: true}
+			}
+
+			c := nodeAtInt(v, pos, path2)
+			if c != nil {
+				return c
+			}
+		}
+
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			c := nodeAtInt(child, pos, append(append([]string{}, path...), strconv.Itoa(i)))
+			if c != nil {
+				return c
+			}
+		}
+
+	case yaml.ScalarNode:
+		if contains(node, pos) {
+			return &cursor{path: path, node: node}
+		}
+	}
+
+	return nil
+}
+
+// contains reports whether a single-line scalar node covers pos.
+func contains(node *yaml.Node, pos position) bool {
+	if node.Kind != yaml.ScalarNode || node.Line-1 != pos.Line {
+		return false
+	}
+
+	width := len(node.Value)
+
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		width += 2
+	}
+
+	start := node.Column - 1
+
+	return pos.Character >= start && pos.Character <= start+width
+}
+
+// nodeRange returns the range of a key or scalar node.
+func nodeRange(node *yaml.Node) lspRange {
+	start := position{Line: node.Line - 1, Character: node.Column - 1}
+	end := start
+
+	if node.Kind == yaml.ScalarNode && !strings.Contains(node.Value, "\n") {
+		end.Character += len(node.Value)
+	}
+
+	return lspRange{Start: start, End: end}
+}
+
+// indentPath returns the map keys enclosing pos, from the indentation of the
+// lines above it. It works on text that doesn't parse yet, e.g. while typing
+// a new key. ok is false inside lists.
+func indentPath(text string, pos position) ([]string, bool) {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return []string{}, true
+	}
+
+	prefix := lines[pos.Line][:min(pos.Character, len(lines[pos.Line]))]
+	indent := len(prefix) - len(strings.TrimLeft(prefix, " "))
+
+	path := []string{}
+
+	for i := pos.Line - 1; i >= 0 && indent > 0; i-- {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line == "---" {
+			break
+		}
+
+		lineIndent := len(line) - len(trimmed)
+		if lineIndent >= indent {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "-") {
+			return nil, false
+		}
+
+		key, _, found := strings.Cut(trimmed, ":")
+		if !found {
+			return nil, false
+		}
+
+		path = append([]string{strings.Trim(key, `"'`)}, path...)
+		indent = lineIndent
+	}
+
+	return path, true
+}
+
+// interpolationAt returns the $"{...}" reference in line under col, if any.
+func interpolationAt(line string, col int) (string, bool) {
+	if !strings.Contains(line, `$"`) {
+		return "", false
+	}
+
+	for _, m := range interpolationRE.FindAllStringSubmatchIndex(line, -1) {
+		if col >= m[0] && col < m[1] {
+			return line[m[2]:m[3]], true
+		}
+	}
+
+	return "", false
+}
+
+// relPath returns path relative to the directory of from, for display.
+func relPath(from string, path string) string {
+	rel, err := filepath.Rel(filepath.Dir(from), path)
+	if err != nil {
+		return path
+	}
+
+	return rel
+}
+
+func lineAt(text string, line int) string {
+	lines := strings.Split(text, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+
+	return lines[line]
+}
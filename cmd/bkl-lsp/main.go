@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gopatchy/bkl/pkg/version"
+	"github.com/jessevdk/go-flags"
+)
+
+type options struct {
+	Stdio   bool `long:"stdio" description:"communicate over stdin/stdout (the default, accepted for editor compatibility)"`
+	Version bool `short:"v" long:"version" description:"print version and exit"`
+}
+
+func main() {
+	opts := &options{}
+
+	fp := flags.NewParser(opts, flags.Default)
+	fp.LongDescription = `
+bkl-lsp is a language server for bkl layer files. It speaks the Language Server Protocol over stdin/stdout and provides diagnostics, hover, go-to-definition and completion.
+
+See https://bkl.gopatchy.io/#bkl-lsp for detailed documentation.`
+
+	_, err := fp.Parse()
+	if err != nil {
+		os.Exit(1)
+	}
+
+	version.PrintVersion(opts.Version)
+
+	err = newServer(os.Stdout).serve(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/fsys"
+)
+
+type server struct {
+	out  io.Writer
+	docs map[string][]byte
+	fsys *fsys.Overlay
+}
+
+func newServer(out io.Writer) *server {
+	docs := map[string][]byte{}
+
+	return &server{
+		out:  out,
+		docs: docs,
+		fsys: fsys.NewOverlay(os.DirFS("/"), docs),
+	}
+}
+
+// serve handles messages from r until the client sends exit or closes the
+// stream.
+func (s *server) serve(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	for {
+		msg, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(msg)
+
+		if msg.ID == nil {
+			continue
+		}
+
+		if rerr != nil {
+			err = writeMessage(s.out, &errorResponse{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Error:   rerr,
+			})
+		} else {
+			err = writeMessage(s.out, &response{
+				JSONRPC: "2.0",
+				ID:      msg.ID,
+				Result:  result,
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(msg *message) (any, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   1,
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"$"},
+				},
+			},
+			"serverInfo": map[string]any{
+				"name": "bkl-lsp",
+			},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		params := &didOpenParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		params := &didChangeParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		if len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+
+	case "textDocument/didSave":
+		s.publishAll()
+
+	case "textDocument/didClose":
+		params := &struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+
+		path, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+
+		delete(s.docs, path)
+		s.publish(params.TextDocument.URI, []diagnostic{})
+		s.publishAll()
+
+	case "textDocument/hover":
+		return positionRequest(msg, s.hover)
+
+	case "textDocument/definition":
+		return positionRequest(msg, s.definition)
+
+	case "textDocument/completion":
+		return positionRequest(msg, s.completion)
+
+	default:
+		if msg.ID != nil {
+			return nil, &responseError{
+				Code:    codeMethodNotFound,
+				Message: fmt.Sprintf("%s: method not found", msg.Method),
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func positionRequest[T any](msg *message, fn func(string, position) (T, error)) (any, *responseError) {
+	params := &textDocumentPositionParams{}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, invalidParams(err)
+	}
+
+	path, err := uriToPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+
+	result, err := fn(path, params.Position)
+	if err != nil {
+		return nil, &responseError{
+			Code:    codeInternalError,
+			Message: err.Error(),
+		}
+	}
+
+	return result, nil
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{
+		Code:    codeInvalidParams,
+		Message: err.Error(),
+	}
+}
+
+// update stores the new text of an open document and re-publishes
+// diagnostics for every open document, since layers that inherit from it may
+// have changed.
+func (s *server) update(uri string, text string) {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return
+	}
+
+	s.docs[path] = []byte(text)
+	s.publishAll()
+}
+
+func (s *server) publishAll() {
+	for path := range s.docs {
+		s.publish(pathToURI(path), s.diagnostics(path))
+	}
+}
+
+func (s *server) publish(uri string, diags []diagnostic) {
+	_ = writeMessage(s.out, &notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: &publishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: diags,
+		},
+	})
+}
+
+// text returns the contents of path, preferring the editor's unsaved copy.
+func (s *server) text(path string) (string, error) {
+	if text, found := s.docs[path]; found {
+		return string(text), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%s: only file:// URIs are supported", uri)
+	}
+
+	return filepath.Clean(u.Path), nil
+}
+
+func pathToURI(path string) string {
+	u := &url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(path),
+	}
+
+	return u.String()
+}
+
+func getOSEnv() map[string]string {
+	env := map[string]string{}
+
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	return env
+}
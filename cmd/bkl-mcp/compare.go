@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/gopatchy/bkl"
@@ -14,15 +15,20 @@ type compareArgs struct {
 	FileSystem  map[string]string `json:"fileSystem,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	Sort        string            `json:"sort,omitempty"`
+	Redact      string            `json:"redact,omitempty"`
+	Selectors   string            `json:"selectors,omitempty"`
+	Report      string            `json:"report,omitempty"`
 }
 
 type compareResponse struct {
-	File1       string            `json:"file1"`
-	File2       string            `json:"file2"`
-	Diff        string            `json:"diff"`
-	Operation   string            `json:"operation"`
-	Environment map[string]string `json:"environment,omitempty"`
-	Sort        string            `json:"sort,omitempty"`
+	File1       string              `json:"file1"`
+	File2       string              `json:"file2"`
+	Diff        string              `json:"diff"`
+	Changes     []bkl.CompareChange `json:"changes"`
+	Report      string              `json:"report,omitempty"`
+	Operation   string              `json:"operation"`
+	Environment map[string]string   `json:"environment,omitempty"`
+	Sort        string              `json:"sort,omitempty"`
 }
 
 func (s *Server) compareHandler(ctx context.Context, args compareArgs) (*compareResponse, error) {
@@ -41,15 +47,53 @@ func (s *Server) compareHandler(ctx context.Context, args compareArgs) (*compare
 		sortPaths = strings.Split(args.Sort, ",")
 	}
 
-	result, err := bkl.Compare(fsys, args.File1, args.File2, "/", workingDir, args.Environment, &args.Format, sortPaths)
+	var redactPaths []string
+	if args.Redact != "" {
+		redactPaths = strings.Split(args.Redact, ",")
+	}
+
+	var selectors []string
+	if args.Selectors != "" {
+		selectors = strings.Split(args.Selectors, ",")
+	}
+
+	result, err := bkl.CompareWithOptions(fsys, args.File1, args.File2, "/", workingDir, args.Environment, &args.Format, &bkl.Options{
+		RedactPaths: redactPaths,
+		Selectors:   selectors,
+	}, sortPaths)
 	if err != nil {
 		return nil, err
 	}
 
+	var report string
+
+	switch args.Report {
+	case "":
+
+	case "text":
+		report = bkl.CompareText(result.Changes)
+
+	case "json":
+		out, err := bkl.CompareJSON(result.Changes)
+		if err != nil {
+			return nil, err
+		}
+
+		report = string(out)
+
+	case "markdown":
+		report = bkl.CompareMarkdown(result.Changes)
+
+	default:
+		return nil, fmt.Errorf("unknown report format %q (want text, json or markdown)", args.Report)
+	}
+
 	return &compareResponse{
 		File1:       result.File1,
 		File2:       result.File2,
 		Diff:        result.Diff,
+		Changes:     result.Changes,
+		Report:      report,
 		Operation:   "compare",
 		Environment: result.Environment,
 		Sort:        strings.Join(result.Sort, ","),
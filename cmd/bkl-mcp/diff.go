@@ -12,7 +12,9 @@ import (
 type diffArgs struct {
 	BaseFile   string            `json:"baseFile"`
 	TargetFile string            `json:"targetFile"`
+	BaseLayers string            `json:"baseLayers,omitempty"`
 	Selectors  string            `json:"selectors,omitempty"`
+	Redact     string            `json:"redact,omitempty"`
 	Format     string            `json:"format,omitempty"`
 	FileSystem map[string]string `json:"fileSystem,omitempty"`
 	OutputPath string            `json:"outputPath,omitempty"`
@@ -42,7 +44,17 @@ func (s *Server) diffHandler(ctx context.Context, args diffArgs) (*diffResponse,
 		selectors = strings.Split(args.Selectors, ",")
 	}
 
-	output, err := bkl.Diff(fsys, args.BaseFile, args.TargetFile, "/", workingDir, selectors, &args.Format, &args.BaseFile, &args.TargetFile)
+	var redact []string
+	if args.Redact != "" {
+		redact = strings.Split(args.Redact, ",")
+	}
+
+	basePaths := []string{args.BaseFile}
+	if args.BaseLayers != "" {
+		basePaths = append(basePaths, strings.Split(args.BaseLayers, ",")...)
+	}
+
+	output, err := bkl.DiffBases(fsys, basePaths, args.TargetFile, "/", workingDir, selectors, &args.Format, &bkl.Options{RedactPaths: redact}, &args.BaseFile, &args.TargetFile)
 	if err != nil {
 		return nil, fmt.Errorf("diff operation failed: %v", err)
 	}
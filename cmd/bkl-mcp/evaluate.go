@@ -10,15 +10,16 @@ import (
 )
 
 type evaluateArgs struct {
-	Files         string            `json:"files,omitempty"`
-	Directory     string            `json:"directory,omitempty"`
-	Pattern       string            `json:"pattern,omitempty"`
-	IncludeOutput *bool             `json:"includeOutput,omitempty"`
-	Format        string            `json:"format,omitempty"`
-	Environment   map[string]string `json:"environment,omitempty"`
-	FileSystem    map[string]string `json:"fileSystem,omitempty"`
-	OutputPath    string            `json:"outputPath,omitempty"`
-	Sort          string            `json:"sort,omitempty"`
+	Files         string             `json:"files,omitempty"`
+	Directory     string             `json:"directory,omitempty"`
+	Pattern       string             `json:"pattern,omitempty"`
+	IncludeOutput *bool              `json:"includeOutput,omitempty"`
+	Format        string             `json:"format,omitempty"`
+	Environment   map[string]string  `json:"environment,omitempty"`
+	FileSystem    map[string]string  `json:"fileSystem,omitempty"`
+	OutputPath    string             `json:"outputPath,omitempty"`
+	Sort          string             `json:"sort,omitempty"`
+	FormatOptions *bkl.FormatOptions `json:"formatOptions,omitempty"`
 }
 
 type evaluateResponse struct {
@@ -66,7 +67,10 @@ func (s *Server) evaluateHandler(ctx context.Context, args evaluateArgs) (*evalu
 			includeOutput = *args.IncludeOutput
 		}
 
-		results, err := bkl.EvaluateTree(fsys, args.Directory, args.Pattern, args.Environment, &args.Format)
+		results, err := bkl.EvaluateTreeWithOptions(fsys, args.Directory, args.Pattern, args.Environment, &args.Format, &bkl.Options{
+			Format: args.FormatOptions,
+			Redact: true,
+		})
 		if err != nil {
 			return nil, fmt.Errorf("directory evaluation failed: %v", err)
 		}
@@ -122,13 +126,22 @@ func (s *Server) evaluateHandler(ctx context.Context, args evaluateArgs) (*evalu
 		sortPaths = strings.Split(args.Sort, ",")
 	}
 
-	output, err := bkl.Evaluate(fsys, files, "/", workingDir, args.Environment, &args.Format, sortPaths, paths...)
+	output, err := bkl.EvaluateWithOptions(fsys, files, "/", workingDir, args.Environment, &args.Format, &bkl.Options{
+		Format: args.FormatOptions,
+		Redact: true,
+	}, sortPaths, paths...)
 	if err != nil {
 		return nil, fmt.Errorf("evaluation failed: %v", err)
 	}
 
 	if args.OutputPath != "" {
-		if err := os.WriteFile(args.OutputPath, output, 0o644); err != nil {
+		// The file gets the real values; only the response is redacted
+		fileOutput, err := bkl.EvaluateWithOptions(fsys, files, "/", workingDir, args.Environment, &args.Format, &bkl.Options{Format: args.FormatOptions}, sortPaths, paths...)
+		if err != nil {
+			return nil, fmt.Errorf("evaluation failed: %v", err)
+		}
+
+		if err := os.WriteFile(args.OutputPath, fileOutput, 0o644); err != nil {
 			return nil, fmt.Errorf("failed to write output to %s: %v", args.OutputPath, err)
 		}
 	}
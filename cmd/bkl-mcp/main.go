@@ -135,9 +135,38 @@ func main() {
 		mcp.WithString("sort",
 			mcp.Description("Sort output documents by path (e.g. 'name' or 'metadata.priority'), comma-separated for multiple"),
 		),
+		mcp.WithObject("formatOptions",
+			mcp.Description("Output style: indent (spaces, default 2), compactSequences (bool), quote ('single' or 'double'), lineWidth (fold long yaml strings), literal (bool, multi-line yaml strings as |), noFinalNewline (bool), preserveTags (bool, keep custom yaml tags like !Ref on input values)"),
+		),
 	)
 	mcpServer.AddTool(evaluateTool, wrapHandler(srv.evaluateHandler))
 
+	queryDataTool := mcp.NewTool("query_data",
+		mcp.WithDescription("Evaluate bkl files and run a jq-style query over the output documents (e.g. '.[] | select(.kind == \"Service\") | .spec.ports')"),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithString("files",
+			mcp.Required(),
+			mcp.Description("Comma-separated list of files to evaluate (relative paths)"),
+		),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("Query expression; the input is the list of output documents. Supports .key, .[\"key\"], .[N], .[key=value], .[], .*, select(PATH OP VALUE) and | pipes"),
+		),
+		formatParam,
+		mcp.WithObject("environment",
+			mcp.Description("Environment variables as key-value pairs"),
+		),
+		fileSystemParam,
+		mcp.WithString("outputPath",
+			mcp.Description("Optional path to write the output to (in addition to returning it)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Sort output documents by path (e.g. 'name' or 'metadata.priority') before querying, comma-separated for multiple"),
+		),
+	)
+	mcpServer.AddTool(queryDataTool, wrapHandler(srv.queryDataHandler))
+
 	diffTool := mcp.NewTool("diff",
 		mcp.WithDescription("Generate the minimal intermediate layer needed to create the target output from the base layer"),
 		mcp.WithReadOnlyHintAnnotation(true),
@@ -150,9 +179,15 @@ func main() {
 			mcp.Required(),
 			mcp.Description("Target file path"),
 		),
+		mcp.WithString("baseLayers",
+			mcp.Description("Further base layer paths, each merged on top of the ones before it, comma-separated for multiple"),
+		),
 		mcp.WithString("selectors",
 			mcp.Description("Selector expressions to match documents (e.g. 'metadata.name,metadata.type'), comma-separated for multiple"),
 		),
+		mcp.WithString("redact",
+			mcp.Description("Paths whose values to hide in the output (e.g. 'db.password'), comma-separated for multiple"),
+		),
 		formatParam,
 		fileSystemParam,
 		mcp.WithString("outputPath",
@@ -211,7 +246,7 @@ func main() {
 	mcpServer.AddTool(issuePromptTool, wrapHandler(srv.issuePromptHandler))
 
 	compareTool := mcp.NewTool("compare",
-		mcp.WithDescription("Evaluate two bkl files and show text differences between their outputs"),
+		mcp.WithDescription("Evaluate two bkl files and show text differences between their outputs, and the values that were added, removed or changed"),
 		mcp.WithReadOnlyHintAnnotation(true),
 		mcp.WithIdempotentHintAnnotation(true),
 		mcp.WithString("file1",
@@ -230,6 +265,15 @@ func main() {
 		mcp.WithString("sort",
 			mcp.Description("Sort output documents by path (e.g. 'name' or 'metadata.priority'), comma-separated for multiple"),
 		),
+		mcp.WithString("redact",
+			mcp.Description("Paths whose values to hide in the diff (e.g. 'db.password'), comma-separated for multiple"),
+		),
+		mcp.WithString("selectors",
+			mcp.Description("Selector expressions to pair documents by (e.g. 'metadata.name'), comma-separated for multiple; documents are paired by position if not specified"),
+		),
+		mcp.WithString("report",
+			mcp.Description("Also format the changes as a report (text, json or markdown)"),
+		),
 	)
 	mcpServer.AddTool(compareTool, wrapHandler(srv.compareHandler))
 
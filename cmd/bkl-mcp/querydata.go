@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gopatchy/bkl"
+)
+
+type queryDataArgs struct {
+	Files       string            `json:"files"`
+	Query       string            `json:"query"`
+	Format      string            `json:"format,omitempty"`
+	Environment map[string]string `json:"environment,omitempty"`
+	FileSystem  map[string]string `json:"fileSystem,omitempty"`
+	OutputPath  string            `json:"outputPath,omitempty"`
+	Sort        string            `json:"sort,omitempty"`
+}
+
+type queryDataResponse struct {
+	Files       []string          `json:"files"`
+	Query       string            `json:"query"`
+	Output      string            `json:"output"`
+	Operation   string            `json:"operation"`
+	Environment map[string]string `json:"environment,omitempty"`
+	OutputPath  string            `json:"outputPath,omitempty"`
+}
+
+func (s *Server) queryDataHandler(ctx context.Context, args queryDataArgs) (*queryDataResponse, error) {
+	if args.Files == "" {
+		return nil, fmt.Errorf("no files provided")
+	}
+
+	if args.Query == "" {
+		return nil, fmt.Errorf("no query provided")
+	}
+
+	workingDir := ""
+	if args.FileSystem != nil {
+		workingDir = "/"
+	}
+
+	fsys, err := getFileSystem(args.FileSystem)
+	if err != nil {
+		return nil, err
+	}
+
+	files := strings.Split(args.Files, ",")
+
+	paths := []*string{}
+	for _, file := range files {
+		paths = append(paths, &file)
+	}
+
+	var sortPaths []string
+	if args.Sort != "" {
+		sortPaths = strings.Split(args.Sort, ",")
+	}
+
+	output, err := bkl.Query(fsys, files, "/", workingDir, args.Environment, args.Query, &args.Format, &bkl.Options{Redact: true}, sortPaths, paths...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+
+	if args.OutputPath != "" {
+		// The file gets the real values; only the response is redacted
+		fileOutput, err := bkl.Query(fsys, files, "/", workingDir, args.Environment, args.Query, &args.Format, nil, sortPaths, paths...)
+		if err != nil {
+			return nil, fmt.Errorf("query failed: %v", err)
+		}
+
+		if err := os.WriteFile(args.OutputPath, fileOutput, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write output to %s: %v", args.OutputPath, err)
+		}
+	}
+
+	return &queryDataResponse{
+		Files:       files,
+		Query:       args.Query,
+		Output:      string(output),
+		Operation:   "query_data",
+		Environment: args.Environment,
+		OutputPath:  args.OutputPath,
+	}, nil
+}
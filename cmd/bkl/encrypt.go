@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+
+	"github.com/gopatchy/bkl"
+	"github.com/jessevdk/go-flags"
+)
+
+type encryptOptions struct {
+	OutputPath *flags.Filename  `short:"o" long:"output" description:"output file path (default: rewrite the layer file in place)"`
+	Method     string           `short:"m" long:"method" description:"encryption method" choice:"age" choice:"pgp" default:"age"`
+	Recipients []string         `short:"r" long:"recipient" description:"age public key (age1...) to encrypt to, can be specified multiple times (default: the key from BKL_AGE_KEY or BKL_AGE_KEY_FILE)"`
+	PGPKeys    []flags.Filename `short:"k" long:"pgp-key" description:"armored PGP public key file to encrypt to, can be specified multiple times (default: the key from BKL_PGP_KEY or BKL_PGP_KEY_FILE)"`
+
+	Positional struct {
+		LayerPath flags.Filename `positional-arg-name:"layerPath" required:"1" description:"layer file path"`
+		KeyPath   string         `positional-arg-name:"keyPath" required:"1" description:"path of the string to encrypt (e.g. 'db.password')"`
+	} `positional-args:"yes"`
+}
+
+func encryptMain(args []string) {
+	opts := &encryptOptions{}
+
+	fp := flags.NewParser(opts, flags.Default)
+	fp.Name = "bkl encrypt"
+	fp.LongDescription = `
+bkl encrypt encrypts a string in a layer file in place, replacing it with a $decode: age (or pgp) directive that evaluates back to the string.
+
+See https://bkl.gopatchy.io/#bkl-encrypt for detailed documentation.`
+
+	_, err := fp.ParseArgs(args)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	recipients := opts.Recipients
+
+	if opts.Method == "pgp" {
+		recipients = nil
+
+		for _, path := range opts.PGPKeys {
+			key, err := os.ReadFile(string(path))
+			if err != nil {
+				fatal(err)
+			}
+
+			recipients = append(recipients, string(key))
+		}
+	}
+
+	fsys := os.DirFS("/")
+	enc, err := bkl.Encrypt(fsys, string(opts.Positional.LayerPath), "/", "", opts.Positional.KeyPath, opts.Method, recipients, nil)
+	if err != nil {
+		fatal(err)
+	}
+
+	outputPath := string(opts.Positional.LayerPath)
+	if opts.OutputPath != nil {
+		outputPath = string(*opts.OutputPath)
+	}
+
+	err = os.WriteFile(outputPath, enc, 0o644)
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/gopatchy/bkl"
+	"github.com/jessevdk/go-flags"
+)
+
+type fmtOptions struct {
+	Check bool `long:"check" description:"don't rewrite files; list those that aren't formatted and exit 1 if there are any"`
+
+	Positional struct {
+		Paths []flags.Filename `positional-arg-name:"path" required:"1" description:"layer file path (YAML, JSON or TOML)"`
+	} `positional-args:"yes"`
+}
+
+func fmtMain(args []string) {
+	opts := &fmtOptions{}
+
+	fp := flags.NewParser(opts, flags.Default)
+	fp.Name = "bkl fmt"
+	fp.LongDescription = `
+bkl fmt rewrites layer files in place in canonical form: consistent indentation, $parent, $match and $output first in each map, $"..." strings with minimal quoting and --- between documents. Comments are kept.
+
+See https://bkl.gopatchy.io/#bkl-fmt for detailed documentation.`
+
+	_, err := fp.ParseArgs(args)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	fsys := os.DirFS("/")
+	unformatted := false
+
+	for _, path := range opts.Positional.Paths {
+		orig, err := os.ReadFile(string(path))
+		if err != nil {
+			fatal(err)
+		}
+
+		out, err := bkl.FormatFile(fsys, string(path), "/", "")
+		if err != nil {
+			fatal(err)
+		}
+
+		if bytes.Equal(orig, out) {
+			continue
+		}
+
+		if opts.Check {
+			fmt.Println(path)
+			unformatted = true
+
+			continue
+		}
+
+		err = os.WriteFile(string(path), out, 0o644)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	if unformatted {
+		os.Exit(1)
+	}
+}
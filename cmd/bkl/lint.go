@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gopatchy/bkl"
+	"github.com/jessevdk/go-flags"
+)
+
+type lintOptions struct {
+	Pattern string `short:"p" long:"pattern" description:"leaf file pattern (e.g. '*.prod.yaml'); default is files that nothing inherits from"`
+	Format  string `short:"f" long:"format" description:"output format" choice:"text" choice:"sarif" default:"text"`
+
+	Positional struct {
+		Directory flags.Filename `positional-arg-name:"directory" required:"1" description:"directory tree to lint"`
+	} `positional-args:"yes"`
+}
+
+func lintMain(args []string) {
+	opts := &lintOptions{}
+
+	fp := flags.NewParser(opts, flags.Default)
+	fp.Name = "bkl lint"
+	fp.LongDescription = `
+bkl lint checks a tree of layer files for overrides that don't change anything, $delete of keys that aren't set, unused $output: false documents and parents, unset $env: variables and misspelled directives. It exits 1 if it finds any issues.
+
+See https://bkl.gopatchy.io/#bkl-lint for detailed documentation.`
+
+	_, err := fp.ParseArgs(args)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	dir := string(opts.Positional.Directory)
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		fatal(err)
+	}
+
+	issues, err := bkl.Lint(os.DirFS("/"), absDir, opts.Pattern, nil)
+	if err != nil {
+		fatal(err)
+	}
+
+	for i := range issues {
+		issues[i].Path = filepath.Join(dir, issues[i].Path)
+	}
+
+	switch opts.Format {
+	case "sarif":
+		out, err := bkl.LintSARIF(issues)
+		if err != nil {
+			fatal(err)
+		}
+
+		os.Stdout.Write(out)
+
+	default:
+		fmt.Print(bkl.LintText(issues))
+	}
+
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"runtime/debug"
+	"path/filepath"
 	"runtime/pprof"
+	"sort"
+	"strings"
 
 	"github.com/gopatchy/bkl"
+	"github.com/gopatchy/bkl/pkg/gc"
 	"github.com/gopatchy/bkl/pkg/log"
 	"github.com/gopatchy/bkl/pkg/version"
 	"github.com/jessevdk/go-flags"
@@ -14,14 +20,23 @@ import (
 
 type options struct {
 	OutputPath   *flags.Filename `short:"o" long:"output" description:"output file path"`
-	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"yaml"`
+	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"env" choice:"hcl" choice:"ini" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"xml" choice:"yaml"`
 	RootPath     string          `short:"r" long:"root-path" description:"restrict file access to this root directory" default:"/"`
 	Sort         []string        `short:"s" long:"sort" description:"sort output documents by path (e.g. 'metadata.name'), can be specified multiple times"`
+	Query        *string         `short:"q" long:"query" description:"print the results of a query over the output documents (e.g. '.[] | select(.kind == \"Service\") | .spec.ports')"`
+	Stream       bool            `long:"stream" description:"read, merge and write the documents of the last input file one at a time (YAML/JSON only; no cross-document references)"`
+	InferSchema  bool            `long:"infer-schema" description:"print a JSON Schema inferred from all files in a directory tree (see --pattern)"`
 	Verbose      bool            `short:"v" long:"verbose" description:"enable verbose logging"`
 	Version      bool            `short:"V" long:"version" description:"print version and exit"`
 	Directory    bool            `short:"d" long:"directory" description:"evaluate all files in directory tree"`
 	Pattern      string          `short:"p" long:"pattern" description:"file pattern to match in directory mode (e.g. '*.yaml')"`
 	ErrorsOnly   bool            `short:"e" long:"errors-only" description:"only show files with errors in directory mode"`
+	OutputDir    *string         `long:"output-dir" description:"write each output document to a file in this directory, named by its $file directive or --file-template"`
+	FileTemplate string          `long:"file-template" description:"file name for output documents without $file, with {path} replaced from the document (e.g. '{metadata.name}.yaml')"`
+	DryRun       bool            `long:"dry-run" description:"with --output-dir, list the files that would be written and removed instead of changing them"`
+	Clean        bool            `long:"clean" description:"with --output-dir, remove files written by the previous run that this run doesn't write"`
+
+	bkl.FormatOptions `group:"Format Options"`
 
 	CPUProfile *string `short:"c" long:"cpu-profile" description:"write CPU profile to file"`
 
@@ -30,8 +45,23 @@ type options struct {
 	} `positional-args:"yes"`
 }
 
+// Subcommands, which take the place of input paths as the first argument.
+var commands = map[string]func(args []string){
+	"encrypt":  encryptMain,
+	"fmt":      fmtMain,
+	"lint":     lintMain,
+	"refactor": refactorMain,
+}
+
 func main() {
-	debug.SetGCPercent(-1)
+	if len(os.Args) > 1 {
+		if cmd, found := commands[os.Args[1]]; found {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
+	gc.Tune(os.Args[1:]...)
 
 	opts := &options{}
 
@@ -41,6 +71,12 @@ bkl interprets layered configuration files from YAML, JSON, and TOML with additi
 
 See https://bkl.gopatchy.io/ for detailed documentation.
 
+Commands:
+* bkl encrypt
+* bkl fmt
+* bkl lint
+* bkl refactor
+
 Related tools:
 * bklb
 * bkld
@@ -84,12 +120,40 @@ Related tools:
 	}
 	defer root.Close()
 
+	bklOpts := &bkl.Options{Format: &opts.FormatOptions}
+
+	if opts.InferSchema {
+		if len(files) != 1 {
+			fatal(fmt.Errorf("--infer-schema requires exactly one directory path"))
+		}
+
+		if opts.Query != nil {
+			fatal(fmt.Errorf("--infer-schema and --query are mutually exclusive"))
+		}
+
+		output, err := bkl.InferSchema(root.FS(), files[0], opts.Pattern, nil, opts.OutputFormat, bklOpts, (*string)(opts.OutputPath))
+		if output != nil {
+			// Files that failed are left out of the schema and reported after it
+			writeOutput(output, opts.OutputPath)
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
 	if opts.Directory {
 		if len(files) != 1 {
 			fatal(fmt.Errorf("directory mode requires exactly one directory path"))
 		}
 
-		results, err := bkl.EvaluateTree(root.FS(), files[0], opts.Pattern, nil, opts.OutputFormat)
+		if opts.Query != nil {
+			fatal(fmt.Errorf("query is not supported in directory mode"))
+		}
+
+		results, err := bkl.EvaluateTreeWithOptions(root.FS(), files[0], opts.Pattern, nil, opts.OutputFormat, bklOpts)
 		if err != nil {
 			fatal(err)
 		}
@@ -121,16 +185,78 @@ Related tools:
 		return
 	}
 
+	if opts.Stream {
+		if opts.Query != nil || len(opts.Sort) > 0 {
+			fatal(fmt.Errorf("--stream can't be combined with --query or --sort"))
+		}
+
+		fh := os.Stdout
+
+		if opts.OutputPath != nil {
+			fh, err = os.Create(string(*opts.OutputPath))
+			if err != nil {
+				fatal(err)
+			}
+
+			defer fh.Close()
+		}
+
+		w := bufio.NewWriter(fh)
+
+		err = bkl.EvaluateStream(root.FS(), files, opts.RootPath, "", nil, opts.OutputFormat, bklOpts, w, (*string)(opts.OutputPath), &files[0])
+		if err != nil {
+			fatal(err)
+		}
+
+		err = w.Flush()
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	if opts.OutputDir != nil {
+		if opts.Query != nil || opts.OutputPath != nil {
+			fatal(fmt.Errorf("--output-dir can't be combined with --query or --output"))
+		}
+
+		results, err := bkl.EvaluateFiles(root.FS(), files, opts.RootPath, "", nil, opts.OutputFormat, bklOpts, opts.FileTemplate, opts.Sort, &files[0])
+		if err != nil {
+			fatal(err)
+		}
+
+		err = writeOutputDir(results, *opts.OutputDir, opts.DryRun, opts.Clean)
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
 	// Regular file mode
-	output, err := bkl.Evaluate(root.FS(), files, opts.RootPath, "", nil, opts.OutputFormat, opts.Sort, (*string)(opts.OutputPath), &files[0])
+	var output []byte
+
+	if opts.Query != nil {
+		output, err = bkl.Query(root.FS(), files, opts.RootPath, "", nil, *opts.Query, opts.OutputFormat, bklOpts, opts.Sort, (*string)(opts.OutputPath), &files[0])
+	} else {
+		output, err = bkl.EvaluateWithOptions(root.FS(), files, opts.RootPath, "", nil, opts.OutputFormat, bklOpts, opts.Sort, (*string)(opts.OutputPath), &files[0])
+	}
+
 	if err != nil {
 		fatal(err)
 	}
 
-	if opts.OutputPath == nil {
+	writeOutput(output, opts.OutputPath)
+}
+
+func writeOutput(output []byte, outputPath *flags.Filename) {
+	var err error
+
+	if outputPath == nil {
 		_, err = os.Stdout.Write(output)
 	} else {
-		err = os.WriteFile(string(*opts.OutputPath), output, 0o644)
+		err = os.WriteFile(string(*outputPath), output, 0o644)
 	}
 
 	if err != nil {
@@ -138,6 +264,80 @@ Related tools:
 	}
 }
 
+// manifestName lists the files written to an output directory, so that --clean
+// can find the ones a later run no longer writes.
+const manifestName = ".bkl-files"
+
+func writeOutputDir(results []bkl.FileResult, dir string, dryRun bool, clean bool) error {
+	written := map[string]bool{}
+	for _, result := range results {
+		written[result.Path] = true
+	}
+
+	manifestPath := filepath.Join(dir, manifestName)
+
+	prev, err := os.ReadFile(manifestPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Files from earlier runs stay in the manifest until they're removed
+	stale := []string{}
+
+	for _, path := range strings.Split(string(prev), "\n") {
+		if path != "" && filepath.IsLocal(path) && !written[path] {
+			stale = append(stale, path)
+		}
+	}
+
+	if dryRun {
+		for _, result := range results {
+			fmt.Printf("write %s\n", filepath.Join(dir, result.Path))
+		}
+
+		if clean {
+			for _, path := range stale {
+				fmt.Printf("remove %s\n", filepath.Join(dir, path))
+			}
+		}
+
+		return nil
+	}
+
+	manifest := []string{}
+
+	for _, result := range results {
+		path := filepath.Join(dir, result.Path)
+
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(path, result.Output, 0o644)
+		if err != nil {
+			return err
+		}
+
+		manifest = append(manifest, result.Path)
+	}
+
+	if clean {
+		for _, path := range stale {
+			err := os.Remove(filepath.Join(dir, path))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	} else {
+		manifest = append(manifest, stale...)
+	}
+
+	sort.Strings(manifest)
+
+	return os.WriteFile(manifestPath, []byte(strings.Join(manifest, "\n")+"\n"), 0o644)
+}
+
 func fatal(err error) {
 	fmt.Fprintf(os.Stderr, "%s\n", err)
 	os.Exit(1)
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+
+	"github.com/gopatchy/bkl"
+	"github.com/jessevdk/go-flags"
+)
+
+type refactorOptions struct {
+	Into      flags.Filename `long:"into" required:"true" description:"base layer file to create (e.g. base.yaml)"`
+	Selectors []string       `short:"s" long:"selector" description:"selector expression to match documents (e.g. 'metadata.name'), can be specified multiple times"`
+
+	Positional struct {
+		Paths []flags.Filename `positional-arg-name:"path" required:"2" description:"layer file path"`
+	} `positional-args:"yes"`
+}
+
+func refactorMain(args []string) {
+	opts := &refactorOptions{}
+
+	fp := flags.NewParser(opts, flags.Default)
+	fp.Name = "bkl refactor"
+	fp.LongDescription = `
+bkl refactor moves what the files have in common into a new base layer, and rewrites each file as a layer on top of it. Files whose names don't already inherit from the base get a $parent. Nothing is written unless every rewritten file evaluates to exactly the same output as before.
+
+See https://bkl.gopatchy.io/#bkl-refactor for detailed documentation.`
+
+	_, err := fp.ParseArgs(args)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	paths := make([]string, len(opts.Positional.Paths))
+	for i, path := range opts.Positional.Paths {
+		paths[i] = string(path)
+	}
+
+	files, err := bkl.Refactor(os.DirFS("/"), paths, string(opts.Into), "/", "", opts.Selectors)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, f := range files {
+		err = os.WriteFile(f.Path, f.Content, 0o644)
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
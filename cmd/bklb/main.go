@@ -4,14 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime/debug"
 	"strings"
 
+	"github.com/gopatchy/bkl/pkg/gc"
 	"github.com/gopatchy/bkl/pkg/wrapper"
 )
 
 func main() {
-	debug.SetGCPercent(-1)
+	gc.Tune(os.Args[1:]...)
 	cmd := filepath.Base(os.Args[0])
 
 	if before, ok := strings.CutSuffix(cmd, "b"); ok {
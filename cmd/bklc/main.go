@@ -10,9 +10,14 @@ import (
 )
 
 type options struct {
-	Format *string  `short:"f" long:"format" description:"output format" choice:"json" choice:"jsonl" choice:"toml" choice:"yaml"`
-	Sort   []string `short:"s" long:"sort" description:"sort output documents by path (e.g. 'metadata.name'), can be specified multiple times"`
-	Color  bool     `short:"c" long:"color" description:"colorize diff output"`
+	Format    *string  `short:"f" long:"format" description:"output format" choice:"env" choice:"hcl" choice:"ini" choice:"json" choice:"jsonl" choice:"toml" choice:"xml" choice:"yaml"`
+	Sort      []string `long:"sort" description:"sort output documents by path (e.g. 'metadata.name'), can be specified multiple times"`
+	Color     bool     `short:"c" long:"color" description:"colorize diff output"`
+	Redact    []string `long:"redact" description:"hide the value at this path (e.g. 'db.password') in the diff, can be specified multiple times"`
+	Changes   string   `long:"changes" optional:"yes" optional-value:"text" choice:"text" choice:"json" choice:"markdown" description:"list the values that were added, removed or changed instead of a text diff"`
+	Selectors []string `short:"s" long:"selector" description:"pair documents by the value at this path (e.g. 'metadata.name'), and sort by it unless --sort is given, can be specified multiple times"`
+
+	bkl.FormatOptions `group:"Format Options"`
 
 	Positional struct {
 		File1 flags.Filename `positional-arg-name:"file1" required:"yes" description:"first file to compare"`
@@ -26,10 +31,18 @@ func main() {
 	fp := flags.NewParser(opts, flags.Default)
 	fp.LongDescription = `bklc compares two bkl files and shows text differences between their outputs.
 
+With --changes, it instead lists the values that were added, removed or
+changed, ignoring key order and formatting, as text, json or markdown.
+
 Examples:
   bklc base.yaml prod.yaml
   bklc -f yaml base.yaml prod.yaml
-  bklc -c base.yaml prod.yaml`
+  bklc -c base.yaml prod.yaml
+  bklc --redact db.password base.yaml prod.yaml
+  bklc --changes=markdown --selector metadata.name base.yaml prod.yaml
+
+Values marked $sensitive: true, decrypted values and --redact paths are
+shown as [REDACTED:<sha256 prefix>].`
 
 	_, err := fp.Parse()
 	if err != nil {
@@ -44,25 +57,49 @@ Examples:
 
 	fsys := os.DirFS("/")
 
-	result, err := bkl.Compare(fsys, file1, file2, "/", "", nil, opts.Format, opts.Sort)
+	result, err := bkl.CompareWithOptions(fsys, file1, file2, "/", "", nil, opts.Format, &bkl.Options{
+		Format:      &opts.FormatOptions,
+		RedactPaths: opts.Redact,
+		Selectors:   opts.Selectors,
+	}, opts.Sort)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if opts.Color {
-		fmt.Print(colorizeDiff(result.Diff))
+	out := result.Diff
+
+	switch opts.Changes {
+	case "text":
+		out = bkl.CompareText(result.Changes)
+
+	case "json":
+		jsonOut, err := bkl.CompareJSON(result.Changes)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		out = string(jsonOut)
+
+	case "markdown":
+		out = bkl.CompareMarkdown(result.Changes)
+	}
+
+	if opts.Color && (opts.Changes == "" || opts.Changes == "text") {
+		fmt.Print(colorizeDiff(out))
 	} else {
-		fmt.Print(result.Diff)
+		fmt.Print(out)
 	}
 }
 
 func colorizeDiff(diff string) string {
 	const (
-		red   = "\033[31m"
-		green = "\033[32m"
-		cyan  = "\033[36m"
-		reset = "\033[0m"
+		red    = "\033[31m"
+		green  = "\033[32m"
+		yellow = "\033[33m"
+		cyan   = "\033[36m"
+		reset  = "\033[0m"
 	)
 
 	lines := strings.Split(diff, "\n")
@@ -78,6 +115,8 @@ func colorizeDiff(diff string) string {
 			result = append(result, red+line+reset)
 		case strings.HasPrefix(line, "+"):
 			result = append(result, green+line+reset)
+		case strings.HasPrefix(line, "~"):
+			result = append(result, yellow+line+reset)
 		default:
 			result = append(result, line)
 		}
@@ -3,33 +3,35 @@ package main
 import (
 	"fmt"
 	"os"
-	"runtime/debug"
 
 	"github.com/gopatchy/bkl"
+	"github.com/gopatchy/bkl/pkg/gc"
 	"github.com/gopatchy/bkl/pkg/version"
 	"github.com/jessevdk/go-flags"
 )
 
 type options struct {
 	OutputPath   *flags.Filename `short:"o" long:"output" description:"output file path"`
-	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"yaml"`
+	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"env" choice:"hcl" choice:"ini" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"xml" choice:"yaml"`
 	Selectors    []string        `short:"s" long:"selector" description:"selector expression to match documents (e.g. 'metadata.name'), can be specified multiple times"`
+	Redact       []string        `long:"redact" description:"hide the value at this path (e.g. 'db.password') in the output, can be specified multiple times"`
 	Version      bool            `short:"v" long:"version" description:"print version and exit"`
 
+	bkl.FormatOptions `group:"Format Options"`
+
 	Positional struct {
-		BasePath   flags.Filename `positional-arg-name:"basePath" description:"base layer file path"`
-		TargetPath flags.Filename `positional-arg-name:"targetPath" description:"target output file path"`
+		Paths []flags.Filename `positional-arg-name:"path" description:"base layer file paths, merged in order, then the target output file path"`
 	} `positional-args:"yes"`
 }
 
 func main() {
-	debug.SetGCPercent(-1)
+	gc.Tune(os.Args[1:]...)
 
 	opts := &options{}
 
 	fp := flags.NewParser(opts, flags.Default)
 	fp.LongDescription = `
-bkld generates the minimal intermediate layer needed to create the target output from the base layer.
+bkld generates the minimal intermediate layer needed to create the target output from the base layer. With several base layers, it diffs against them merged in order.
 
 See https://bkl.gopatchy.io/#bkld for detailed documentation.`
 
@@ -40,13 +42,24 @@ See https://bkl.gopatchy.io/#bkld for detailed documentation.`
 
 	version.PrintVersion(opts.Version)
 
-	if opts.Positional.BasePath == "" || opts.Positional.TargetPath == "" {
+	if len(opts.Positional.Paths) < 2 {
 		fp.WriteHelp(os.Stderr)
 		os.Exit(1)
 	}
 
+	paths := make([]string, len(opts.Positional.Paths))
+	for i, path := range opts.Positional.Paths {
+		paths[i] = string(path)
+	}
+
+	basePaths := paths[:len(paths)-1]
+	targetPath := paths[len(paths)-1]
+
 	fsys := os.DirFS("/")
-	enc, err := bkl.Diff(fsys, string(opts.Positional.BasePath), string(opts.Positional.TargetPath), "/", "", opts.Selectors, opts.OutputFormat, (*string)(opts.OutputPath), (*string)(&opts.Positional.BasePath))
+	enc, err := bkl.DiffBases(fsys, basePaths, targetPath, "/", "", opts.Selectors, opts.OutputFormat, &bkl.Options{
+		Format:      &opts.FormatOptions,
+		RedactPaths: opts.Redact,
+	}, (*string)(opts.OutputPath), &basePaths[0])
 	if err != nil {
 		fatal(err)
 	}
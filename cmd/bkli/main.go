@@ -3,26 +3,28 @@ package main
 import (
 	"fmt"
 	"os"
-	"runtime/debug"
 
 	"github.com/gopatchy/bkl"
+	"github.com/gopatchy/bkl/pkg/gc"
 	"github.com/gopatchy/bkl/pkg/version"
 	"github.com/jessevdk/go-flags"
 )
 
 type options struct {
 	OutputPath   *flags.Filename `short:"o" long:"output" description:"output file path"`
-	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"yaml"`
+	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"env" choice:"hcl" choice:"ini" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"xml" choice:"yaml"`
 	Selectors    []string        `short:"s" long:"selector" description:"selector expression to match documents (e.g. 'metadata.name'), can be specified multiple times"`
 	Version      bool            `short:"v" long:"version" description:"print version and exit"`
 
+	bkl.FormatOptions `group:"Format Options"`
+
 	Positional struct {
 		InputPaths []flags.Filename `positional-arg-name:"targetPath" description:"target output file path"`
 	} `positional-args:"yes"`
 }
 
 func main() {
-	debug.SetGCPercent(-1)
+	gc.Tune(os.Args[1:]...)
 
 	opts := &options{}
 
@@ -50,7 +52,7 @@ See https://bkl.gopatchy.io/#bkli for detailed documentation.`
 	}
 
 	fsys := os.DirFS("/")
-	enc, err := bkl.Intersect(fsys, paths, "/", "", opts.Selectors, opts.OutputFormat, (*string)(opts.OutputPath), &paths[0])
+	enc, err := bkl.IntersectWithOptions(fsys, paths, "/", "", opts.Selectors, opts.OutputFormat, &bkl.Options{Format: &opts.FormatOptions}, (*string)(opts.OutputPath), &paths[0])
 	if err != nil {
 		fatal(err)
 	}
@@ -3,25 +3,27 @@ package main
 import (
 	"fmt"
 	"os"
-	"runtime/debug"
 
 	"github.com/gopatchy/bkl"
+	"github.com/gopatchy/bkl/pkg/gc"
 	"github.com/gopatchy/bkl/pkg/version"
 	"github.com/jessevdk/go-flags"
 )
 
 type options struct {
 	OutputPath   *flags.Filename `short:"o" long:"output" description:"output file path"`
-	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"yaml"`
+	OutputFormat *string         `short:"f" long:"format" description:"output format" choice:"env" choice:"hcl" choice:"ini" choice:"json" choice:"json-pretty" choice:"jsonl" choice:"toml" choice:"xml" choice:"yaml"`
 	Version      bool            `short:"v" long:"version" description:"print version and exit"`
 
+	bkl.FormatOptions `group:"Format Options"`
+
 	Positional struct {
 		InputPath flags.Filename `positional-arg-name:"layerPath" description:"lower layer file path"`
 	} `positional-args:"yes"`
 }
 
 func main() {
-	debug.SetGCPercent(-1)
+	gc.Tune(os.Args[1:]...)
 
 	opts := &options{}
 
@@ -44,7 +46,7 @@ See https://bkl.gopatchy.io/#bklr for detailed documentation.`
 	}
 
 	fsys := os.DirFS("/")
-	enc, err := bkl.Required(fsys, string(opts.Positional.InputPath), "/", "", opts.OutputFormat, (*string)(opts.OutputPath), (*string)(&opts.Positional.InputPath))
+	enc, err := bkl.RequiredWithOptions(fsys, string(opts.Positional.InputPath), "/", "", opts.OutputFormat, &bkl.Options{Format: &opts.FormatOptions}, (*string)(opts.OutputPath), (*string)(&opts.Positional.InputPath))
 	if err != nil {
 		fatal(err)
 	}
@@ -1,8 +1,19 @@
 package bkl
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/fs"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/redact"
 
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
@@ -14,17 +25,73 @@ type CompareResult struct {
 	File2       string
 	Format      string
 	Diff        string
+	Changes     []CompareChange
 	Environment map[string]string
 	Sort        []string
+	Redact      []string
+	Selectors   []string
+}
+
+// CompareChange is a value that differs between the outputs compared.
+// Document is the selector values of the document, joined by "|", or its
+// position if there are no selectors and either side doesn't have exactly
+// one document. Path is in the syntax that --sort and --redact take (e.g.
+// "spec.containers[name=web].image"), with list entries as [key=value] or
+// [index], and keys containing any of .[]\" quoted as ["key"]. It's
+// empty if the whole document was added or removed. Type is "added",
+// "removed", "changed" or "moved". Old is null for added values and New for
+// removed ones. For a list entry that moved relative to the others, Old and
+// New are its old and new positions; it also gets changes for its values.
+type CompareChange struct {
+	Document string `json:"document,omitempty"`
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	Old      any    `json:"old"`
+	New      any    `json:"new"`
 }
 
+// Compare evaluates file1 and file2 and returns a unified diff of their
+// outputs, and the values that differ between them. Documents are paired
+// by position; lists of maps are paired by a field that identifies their
+// entries, like bkld does, and entries whose order changed are reported as
+// moved. Values marked $sensitive and decrypted values are
+// replaced with placeholders before comparing, so they don't appear in the
+// diff or the changes.
 func Compare(fsys fs.FS, file1, file2 string, rootPath, workingDir string, env map[string]string, format *string, sort []string) (*CompareResult, error) {
-	output1, err := Evaluate(fsys, []string{file1}, rootPath, workingDir, env, format, sort, &file1)
+	return CompareWithOptions(fsys, file1, file2, rootPath, workingDir, env, format, nil, sort)
+}
+
+// CompareWithOptions is Compare with Options: documents are paired by the
+// values at opts.Selectors, if any, and also sorted by them for the diff if
+// sort is empty. The values at opts.RedactPaths are also replaced with
+// placeholders. If opts is nil, it behaves like Compare.
+func CompareWithOptions(fsys fs.FS, file1, file2 string, rootPath, workingDir string, env map[string]string, format *string, opts *Options, sort []string) (*CompareResult, error) {
+	docSort := sort
+	if len(docSort) == 0 {
+		docSort = opts.selectors()
+	}
+
+	docs1, ft1, err := evaluateRedact(fsys, file1, rootPath, workingDir, env, format, opts, docSort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %s: %w", file1, err)
+	}
+
+	docs2, ft2, err := evaluateRedact(fsys, file2, rootPath, workingDir, env, format, opts, docSort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %s: %w", file2, err)
+	}
+
+	changes, err := compareDocs(docs1, docs2, opts.selectors())
+	if err != nil {
+		return nil, err
+	}
+
+	output1, err := ft1.MarshalStream(docs1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate %s: %w", file1, err)
 	}
 
-	output2, err := Evaluate(fsys, []string{file2}, rootPath, workingDir, env, format, sort, &file2)
+	output2, err := ft2.MarshalStream(docs2)
 	if err != nil {
 		return nil, fmt.Errorf("failed to evaluate %s: %w", file2, err)
 	}
@@ -42,9 +109,413 @@ func Compare(fsys fs.FS, file1, file2 string, rootPath, workingDir string, env m
 		File2:       file2,
 		Format:      finalFormat,
 		Diff:        unified,
+		Changes:     changes,
 		Environment: env,
 		Sort:        sort,
+		Redact:      opts.redactPaths(),
+		Selectors:   opts.selectors(),
 	}
 
 	return result, nil
 }
+
+// evaluateRedact returns the output documents of path, with sensitive values
+// and the values at the redact paths replaced with placeholders, and the
+// format to write them in.
+func evaluateRedact(fx fs.FS, path string, rootPath string, workingDir string, env map[string]string, format *string, opts *Options, sort []string) ([]any, *format.Format, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	realFiles, inferredFormat, err := resolveFiles(fx, []string{path}, rootPath, workingDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ft, err := determineFormat(format, opts.format(), &path, &inferredFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outputs, err := merge.Outputs(fx, realFiles, env, &ft.Options, sort, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i, out := range outputs {
+		outputs[i] = redact.Paths(out, opts.redactPaths())
+	}
+
+	return outputs, ft, nil
+}
+
+// compareDocs pairs docs1 and docs2 and returns the changes between each
+// pair, then the documents only in docs2.
+func compareDocs(docs1, docs2 []any, selectors []string) ([]CompareChange, error) {
+	keys1, err := compareDocKeys(docs1, selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	keys2, err := compareDocKeys(docs2, selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	label := func(key string) string {
+		if len(selectors) == 0 && len(docs1) == 1 && len(docs2) == 1 {
+			return ""
+		}
+
+		return key
+	}
+
+	changes := []CompareChange{}
+
+	for i, doc1 := range docs1 {
+		j := slices.Index(keys2, keys1[i])
+		if j == -1 {
+			changes = append(changes, CompareChange{Document: label(keys1[i]), Type: "removed", Old: doc1})
+			continue
+		}
+
+		changes = compareValues(changes, label(keys1[i]), "", doc1, docs2[j])
+	}
+
+	for j, doc2 := range docs2 {
+		if !slices.Contains(keys1, keys2[j]) {
+			changes = append(changes, CompareChange{Document: label(keys2[j]), Type: "added", New: doc2})
+		}
+	}
+
+	return changes, nil
+}
+
+// compareDocKeys returns the selector values of each of docs, or their
+// positions if there are no selectors.
+func compareDocKeys(docs []any, selectors []string) ([]string, error) {
+	keys := []string{}
+
+	for i, doc := range docs {
+		key := strconv.Itoa(i)
+		if len(selectors) > 0 {
+			key = selectorKey(doc, selectors)
+		}
+
+		if slices.Contains(keys, key) {
+			return nil, fmt.Errorf("selector %q matches multiple documents", key)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// compareValues appends the changes between v1 and v2 at path to changes.
+func compareValues(changes []CompareChange, doc string, path string, v1, v2 any) []CompareChange {
+	switch {
+	case reflect.DeepEqual(v1, v2):
+		return changes
+
+	case isMap(v1) && isMap(v2):
+		m1 := v1.(map[string]any)
+		m2 := v2.(map[string]any)
+
+		for _, k := range slices.Sorted(maps.Keys(mergeKeys(m1, m2))) {
+			kv1, found1 := m1[k]
+			kv2, found2 := m2[k]
+
+			switch {
+			case !found1:
+				changes = append(changes, CompareChange{Document: doc, Path: comparePath(path, k), Type: "added", New: kv2})
+			case !found2:
+				changes = append(changes, CompareChange{Document: doc, Path: comparePath(path, k), Type: "removed", Old: kv1})
+			default:
+				changes = compareValues(changes, doc, comparePath(path, k), kv1, kv2)
+			}
+		}
+
+		return changes
+
+	case isList(v1) && isList(v2):
+		return compareLists(changes, doc, path, v1.([]any), v2.([]any))
+
+	default:
+		return append(changes, CompareChange{Document: doc, Path: path, Type: "changed", Old: v1, New: v2})
+	}
+}
+
+// compareLists pairs the entries of l1 and l2 by a field that identifies
+// them, ignoring order, or else by value in order, and appends the changes
+// between them to changes.
+func compareLists(changes []CompareChange, doc string, path string, l1, l2 []any) []CompareChange {
+	key := listIdentityKey(l1, l2)
+
+	if key != "" {
+		entryPath := func(v any) string {
+			return fmt.Sprintf("%s[%s=%v]", path, key, v.(map[string]any)[key])
+		}
+
+		find := func(l []any, v any) int {
+			return slices.IndexFunc(l, func(e any) bool { return e.(map[string]any)[key] == v.(map[string]any)[key] })
+		}
+
+		moved := movedEntries(l1, l2, entryPath)
+
+		for i, v1 := range l1 {
+			j := find(l2, v1)
+			if j == -1 {
+				changes = append(changes, CompareChange{Document: doc, Path: entryPath(v1), Type: "removed", Old: v1})
+				continue
+			}
+
+			if moved[entryPath(v1)] {
+				changes = append(changes, CompareChange{Document: doc, Path: entryPath(v1), Type: "moved", Old: i, New: j})
+			}
+
+			changes = compareValues(changes, doc, entryPath(v1), v1, l2[j])
+		}
+
+		for _, v2 := range l2 {
+			if find(l1, v2) == -1 {
+				changes = append(changes, CompareChange{Document: doc, Path: entryPath(v2), Type: "added", New: v2})
+			}
+		}
+
+		return changes
+	}
+
+	ids := func(l []any) []string {
+		ret := make([]string, len(l))
+		for i, v := range l {
+			ret[i] = fmt.Sprintf("%#v", v)
+		}
+
+		return ret
+	}
+
+	pairs := lcs(ids(l1), ids(l2))
+
+	i, j := 0, 0
+
+	for _, pair := range append(pairs, [2]int{len(l1), len(l2)}) {
+		// Unpaired entries at the same position are changes, not a removal
+		// and an addition
+		for ; i < pair[0] && j < pair[1]; i, j = i+1, j+1 {
+			changes = compareValues(changes, doc, fmt.Sprintf("%s[%d]", path, i), l1[i], l2[j])
+		}
+
+		for ; i < pair[0]; i++ {
+			changes = append(changes, CompareChange{Document: doc, Path: fmt.Sprintf("%s[%d]", path, i), Type: "removed", Old: l1[i]})
+		}
+
+		for ; j < pair[1]; j++ {
+			changes = append(changes, CompareChange{Document: doc, Path: fmt.Sprintf("%s[%d]", path, j), Type: "added", New: l2[j]})
+		}
+
+		i, j = pair[0]+1, pair[1]+1
+	}
+
+	return changes
+}
+
+// movedEntries returns the ids of the entries in both l1 and l2 whose order
+// relative to the others changed: those outside the longest run of shared
+// entries that keeps its order.
+func movedEntries(l1, l2 []any, id func(any) string) map[string]bool {
+	ids := func(l []any, other []any) []string {
+		ret := []string{}
+
+		for _, v := range l {
+			if slices.ContainsFunc(other, func(o any) bool { return id(o) == id(v) }) {
+				ret = append(ret, id(v))
+			}
+		}
+
+		return ret
+	}
+
+	ids1 := ids(l1, l2)
+	ids2 := ids(l2, l1)
+
+	ret := map[string]bool{}
+	for _, v := range ids1 {
+		ret[v] = true
+	}
+
+	for _, pair := range lcs(ids1, ids2) {
+		delete(ret, ids1[pair[0]])
+	}
+
+	return ret
+}
+
+// comparePath returns path with key appended, quoted if query syntax
+// would split it.
+func comparePath(path string, key string) string {
+	if strings.ContainsAny(key, `.[]\"`) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func mergeKeys(m1, m2 map[string]any) map[string]any {
+	ret := maps.Clone(m1)
+	maps.Copy(ret, m2)
+
+	return ret
+}
+
+func isMap(v any) bool {
+	_, ok := v.(map[string]any)
+	return ok
+}
+
+func isList(v any) bool {
+	_, ok := v.([]any)
+	return ok
+}
+
+// CompareText formats changes one per line: "+" for added, "-" for removed,
+// "~" for changed values and ">" for moved list entries.
+func CompareText(changes []CompareChange) string {
+	buf := &strings.Builder{}
+
+	for _, change := range changes {
+		switch change.Type {
+		case "added":
+			fmt.Fprintf(buf, "+ %s: %s\n", compareLocation(change), compareValue(change.New))
+		case "removed":
+			fmt.Fprintf(buf, "- %s: %s\n", compareLocation(change), compareValue(change.Old))
+		case "moved":
+			fmt.Fprintf(buf, "> %s: moved from %s to %s\n", compareLocation(change), compareValue(change.Old), compareValue(change.New))
+		default:
+			fmt.Fprintf(buf, "~ %s: %s -> %s\n", compareLocation(change), compareValue(change.Old), compareValue(change.New))
+		}
+	}
+
+	return buf.String()
+}
+
+// CompareJSON formats changes as a JSON list.
+func CompareJSON(changes []CompareChange) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CompareMarkdown formats changes as a Markdown table, e.g. for a pull
+// request comment.
+func CompareMarkdown(changes []CompareChange) string {
+	if len(changes) == 0 {
+		return "No changes.\n"
+	}
+
+	hasDoc := slices.ContainsFunc(changes, func(c CompareChange) bool { return c.Document != "" })
+
+	cell := func(v any, set bool) string {
+		if !set {
+			return ""
+		}
+
+		return markdownCode(compareValue(v))
+	}
+
+	buf := &strings.Builder{}
+
+	if hasDoc {
+		buf.WriteString("| Document | Path | Change | Old | New |\n| --- | --- | --- | --- | --- |\n")
+	} else {
+		buf.WriteString("| Path | Change | Old | New |\n| --- | --- | --- | --- |\n")
+	}
+
+	for _, change := range changes {
+		if hasDoc {
+			fmt.Fprintf(buf, "| %s ", strings.ReplaceAll(change.Document, "|", `\|`))
+		}
+
+		path := ""
+		if change.Path != "" {
+			path = markdownCode(change.Path)
+		}
+
+		fmt.Fprintf(buf, "| %s | %s | %s | %s |\n",
+			path,
+			change.Type,
+			cell(change.Old, change.Type != "added"),
+			cell(change.New, change.Type != "removed"),
+		)
+	}
+
+	return buf.String()
+}
+
+// markdownCode returns s as a Markdown code span in a table cell. The fence
+// is one backtick longer than the longest run of backticks in s, so those
+// stay literal.
+func markdownCode(s string) string {
+	longest, run := 0, 0
+
+	for _, c := range s {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	fence := strings.Repeat("`", longest+1)
+
+	// A space on each side keeps a leading or trailing backtick from
+	// joining the fence; Markdown strips one of each
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+
+	return fence + strings.ReplaceAll(s, "|", `\|`) + fence
+}
+
+// compareLocation returns the document and path of change as text.
+func compareLocation(change CompareChange) string {
+	switch {
+	case change.Document == "" && change.Path == "":
+		return "."
+	case change.Document == "":
+		return change.Path
+	case change.Path == "":
+		return "[" + change.Document + "]"
+	default:
+		return "[" + change.Document + "] " + change.Path
+	}
+}
+
+// compareValue returns v as compact JSON.
+func compareValue(v any) string {
+	buf := &bytes.Buffer{}
+
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -1,6 +1,7 @@
 package bkl
 
 import (
+	"cmp"
 	"fmt"
 	"io/fs"
 	"maps"
@@ -13,34 +14,45 @@ import (
 	"github.com/gopatchy/bkl/internal/fsys"
 	"github.com/gopatchy/bkl/internal/merge"
 	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/process"
+	"github.com/gopatchy/bkl/internal/redact"
 	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
 )
 
+// Diff returns the layer that turns the output of srcPath into that of
+// dstPath. Values marked $sensitive are replaced with placeholders before
+// diffing.
 func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string, selectors []string, format *string, paths ...*string) ([]byte, error) {
-	preparedPaths, err := utils.PreparePathsForParser([]string{srcPath, dstPath}, rootPath, workingDir)
-	if err != nil {
-		return nil, err
-	}
-	srcPath = preparedPaths[0]
-	dstPath = preparedPaths[1]
+	return DiffWithOptions(fx, srcPath, dstPath, rootPath, workingDir, selectors, format, nil, paths...)
+}
 
-	var srcDocs []*document.Document
+// DiffWithOptions is Diff with Options: the values at opts.RedactPaths (e.g.
+// "db.password") are also replaced with placeholders. If opts is nil, it
+// behaves like Diff.
+func DiffWithOptions(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string, selectors []string, format *string, opts *Options, paths ...*string) ([]byte, error) {
+	return DiffBases(fx, []string{srcPath}, dstPath, rootPath, workingDir, selectors, format, opts, paths...)
+}
 
-	realSrcPath, _, err := file.FileMatch(fx, srcPath)
-	if err != nil {
-		return nil, fmt.Errorf("source file %s: %w", srcPath, err)
+// DiffBases is Diff from the output of several base layers, merged in
+// order as if they were evaluated together. Each base may have parents of
+// its own. It checks that the layer it returns turns each base document
+// into its target.
+func DiffBases(fx fs.FS, srcPaths []string, dstPath string, rootPath string, workingDir string, selectors []string, format *string, opts *Options, paths ...*string) ([]byte, error) {
+	if len(srcPaths) == 0 {
+		return nil, fmt.Errorf("diff requires at least 1 base file: %w", errors.ErrInvalidArguments)
 	}
 
-	fileObjs, err := file.LoadAndParents(fsys.New(fx), realSrcPath, nil)
+	preparedPaths, err := utils.PreparePathsForParser(append(slices.Clone(srcPaths), dstPath), rootPath, workingDir)
 	if err != nil {
-		return nil, fmt.Errorf("loading source %s: %w", srcPath, err)
+		return nil, err
 	}
+	srcPaths = preparedPaths[:len(srcPaths)]
+	dstPath = preparedPaths[len(srcPaths)]
 
-	for _, f := range fileObjs {
-		srcDocs, err = merge.FileObj(srcDocs, f)
-		if err != nil {
-			return nil, fmt.Errorf("merging source %s: %w", srcPath, err)
-		}
+	srcDocs, err := mergeBases(fx, srcPaths, opts.format())
+	if err != nil {
+		return nil, err
 	}
 
 	var dstDocs []*document.Document
@@ -51,7 +63,7 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 	}
 
 	fileSystem2 := fsys.New(fx)
-	fileObjs2, err := file.LoadAndParents(fileSystem2, realDstPath, nil)
+	fileObjs2, err := file.LoadAndParents(fileSystem2, realDstPath, nil, getOSEnv(), opts.format())
 	if err != nil {
 		return nil, fmt.Errorf("loading destination %s: %w", dstPath, err)
 	}
@@ -63,15 +75,16 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 		}
 	}
 
+	for _, doc := range append(srcDocs, dstDocs...) {
+		doc.Data = redact.Paths(doc.Sensitive.Apply(doc.Data), opts.redactPaths())
+	}
+
 	results := []any{}
 
 	srcMap := make(map[string]*document.Document)
 	var srcKeys []string
 	for _, doc := range srcDocs {
-		keyStr, err := evaluateSelectors(doc, selectors)
-		if err != nil {
-			return nil, fmt.Errorf("evaluating selectors on source document: %w", err)
-		}
+		keyStr := selectorKey(doc.Data, selectors)
 		if _, exists := srcMap[keyStr]; exists {
 			return nil, fmt.Errorf("selector %q matches multiple source documents", keyStr)
 		}
@@ -82,10 +95,7 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 	dstMap := make(map[string]*document.Document)
 	var dstKeys []string
 	for _, doc := range dstDocs {
-		keyStr, err := evaluateSelectors(doc, selectors)
-		if err != nil {
-			return nil, fmt.Errorf("evaluating selectors on destination document: %w", err)
-		}
+		keyStr := selectorKey(doc.Data, selectors)
 		if _, exists := dstMap[keyStr]; exists {
 			return nil, fmt.Errorf("selector %q matches multiple destination documents", keyStr)
 		}
@@ -99,6 +109,7 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 		if !found {
 			switch d := dstDoc.Data.(type) {
 			case map[string]any:
+				d = maps.Clone(d)
 				d["$match"] = nil
 				results = append(results, d)
 			default:
@@ -110,6 +121,11 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 				return nil, err
 			}
 
+			err = verifyDiff(srcDoc.Data, dstDoc.Data, result)
+			if err != nil {
+				return nil, fmt.Errorf("selector %q: %w", keyStr, err)
+			}
+
 			matchValue := buildMatchValue(srcDoc.Data, selectors)
 			result = addMatchDirective(result, matchValue)
 			results = append(results, result)
@@ -128,13 +144,61 @@ func Diff(fx fs.FS, srcPath, dstPath string, rootPath string, workingDir string,
 		}
 	}
 
-	ft, err := determineFormat(format, paths...)
+	ft, err := determineFormat(format, opts.format(), paths...)
 	if err != nil {
 		return nil, err
 	}
+
 	return ft.MarshalStream(results)
 }
 
+// mergeBases merges paths as a chain of layers: each path, with its own
+// parents, on top of the ones before it. Files already in the chain are
+// merged once.
+func mergeBases(fx fs.FS, paths []string, opts *FormatOptions) ([]*document.Document, error) {
+	var docs []*document.Document
+
+	merged := map[string]bool{}
+
+	for i, path := range paths {
+		realPath, _, err := file.FileMatch(fx, path)
+		if err != nil {
+			return nil, fmt.Errorf("source file %s: %w", path, err)
+		}
+
+		fileObjs, err := file.LoadAndParents(fsys.New(fx), realPath, nil, getOSEnv(), opts)
+		if err != nil {
+			return nil, fmt.Errorf("loading source %s: %w", path, err)
+		}
+
+		// IDs of the documents merged for this path
+		ids := map[string]bool{}
+
+		for _, f := range fileObjs {
+			if merged[f.Path] {
+				continue
+			}
+
+			merged[f.Path] = true
+
+			for _, doc := range f.Docs {
+				if i > 0 && !slices.ContainsFunc(doc.Parents, func(p *document.Document) bool { return ids[p.ID] }) {
+					doc.Parents = slices.Clone(docs)
+				}
+
+				ids[doc.ID] = true
+			}
+
+			docs, err = merge.FileObj(docs, f)
+			if err != nil {
+				return nil, fmt.Errorf("merging source %s: %w", path, err)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
 func diff(dst, src any) (any, error) {
 	switch dst2 := dst.(type) {
 	case map[string]any:
@@ -157,8 +221,18 @@ func diffMap(dst map[string]any, src any) (any, error) {
 	case map[string]any:
 		return diffMapMap(dst, src2)
 
-	default:
+	case []any:
+		// Merging a map into a list of maps would add it as an entry
+		if utils.IsListOfMaps(src2) {
+			ret := maps.Clone(dst)
+			ret["$replace"] = true
+
+			return ret, nil
+		}
+
+		return dst, nil
 
+	default:
 		return dst, nil
 	}
 }
@@ -204,69 +278,308 @@ func diffList(dst []any, src any) (any, error) {
 	case []any:
 		return diffListList(dst, src2)
 
+	case map[string]any:
+		// Merging a list of maps into a map would keep the map as an entry
+		if utils.IsListOfMaps(dst) {
+			return append(slices.Clone(dst), map[string]any{"$replace": true}), nil
+		}
+
+		return dst, nil
+
 	default:
 		return dst, nil
 	}
 }
 
+// diffListList returns the list entries that turn src into dst: $delete for
+// entries that are gone, $match edits for entries that changed, and
+// $prepend, $insertAfter or plain appends for new entries. Entries are
+// paired by a field that identifies them, if the entries are maps that have
+// one, or else by value. It falls back to $replace if no entries pair up,
+// or if the entries don't reproduce dst.
 func diffListList(dst, src []any) (any, error) {
+	if reflect.DeepEqual(dst, src) {
+		return nil, nil
+	}
+
+	ret, paired, err := diffListEntries(dst, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if (paired == 0 && len(src) > 0) || verifyDiff(src, dst, ret) != nil {
+		return append(slices.Clone(dst), map[string]any{"$replace": true}), nil
+	}
+
+	return ret, nil
+}
+
+// diffListEntries returns the list entries that turn src into dst and the
+// number of entries that pair up.
+func diffListEntries(dst, src []any) ([]any, int, error) {
+	key := listIdentityKey(dst, src)
+
+	id := func(v any) string {
+		if key != "" {
+			return fmt.Sprintf("%#v", v.(map[string]any)[key])
+		}
+
+		return fmt.Sprintf("%#v", v)
+	}
+
+	pattern := func(v any) any {
+		if key != "" {
+			return map[string]any{key: v.(map[string]any)[key]}
+		}
+
+		return v
+	}
+
+	srcIDs := make([]string, len(src))
+	for i, v := range src {
+		srcIDs[i] = id(v)
+	}
+
+	dstIDs := make([]string, len(dst))
+	for i, v := range dst {
+		dstIDs[i] = id(v)
+	}
+
+	pairs := lcs(srcIDs, dstIDs)
+
+	srcPaired := map[int]int{}
+	dstPaired := map[int]bool{}
+
+	for _, pair := range pairs {
+		srcPaired[pair[0]] = pair[1]
+		dstPaired[pair[1]] = true
+	}
+
 	ret := []any{}
+	deleted := map[string]bool{}
 
-outer1:
-	for _, v1 := range dst {
-		for _, v2 := range src {
-			if reflect.DeepEqual(v1, v2) {
-				continue outer1
-			}
+	for i, v := range src {
+		if _, found := srcPaired[i]; found || deleted[srcIDs[i]] {
+			continue
+		}
+
+		deleted[srcIDs[i]] = true
+		ret = append(ret, map[string]any{"$delete": pattern(v)})
+	}
+
+	for _, pair := range pairs {
+		edit, err := diff(dst[pair[1]], src[pair[0]])
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if edit == nil {
+			continue
+		}
+
+		editMap, ok := edit.(map[string]any)
+		if !ok || key == "" {
+			return nil, 0, fmt.Errorf("%#v: %w", edit, errors.ErrInvalidType)
 		}
 
-		ret = append(ret, v1)
+		editMap = maps.Clone(editMap)
+		editMap["$match"] = pattern(dst[pair[1]])
+		ret = append(ret, editMap)
+	}
+
+	lastPaired := -1
+	for j := range dst {
+		if dstPaired[j] {
+			lastPaired = j
+		}
+	}
+
+	for j, v := range dst {
+		switch {
+		case dstPaired[j]:
+			continue
+
+		case j > lastPaired:
+			ret = append(ret, v)
+
+		case j == 0:
+			ret = append(ret, listEntry(v, "$prepend", true))
+
+		default:
+			ret = append(ret, listEntry(v, "$insertAfter", pattern(dst[j-1])))
+		}
+	}
+
+	return ret, len(pairs), nil
+}
+
+// listEntry returns v as a list entry with the directive k set to val.
+func listEntry(v any, k string, val any) map[string]any {
+	if m, ok := v.(map[string]any); ok {
+		ret := maps.Clone(m)
+		ret[k] = val
+
+		return ret
+	}
+
+	return map[string]any{k: val, "$value": v}
+}
+
+// listIdentityKey returns a field that every entry of every list has, with a
+// scalar value that's different for each entry of a list, or "".
+func listIdentityKey(lists ...[]any) string {
+	candidates := []string{}
+
+	for _, list := range lists {
+		for _, v := range list {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return ""
+			}
+
+			for k := range m {
+				if !strings.HasPrefix(k, "$") && !slices.Contains(candidates, k) {
+					candidates = append(candidates, k)
+				}
+			}
+		}
 	}
 
-outer2:
-	for _, v1 := range src {
-		for _, v2 := range dst {
-			if reflect.DeepEqual(v1, v2) {
-				continue outer2
+	slices.SortFunc(candidates, func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(identityKeyRank(a), identityKeyRank(b)),
+			strings.Compare(a, b),
+		)
+	})
+
+outer:
+	for _, k := range candidates {
+		for _, list := range lists {
+			seen := map[any]bool{}
+
+			for _, v := range list {
+				kv, found := v.(map[string]any)[k]
+				if !found {
+					continue outer
+				}
+
+				switch kv.(type) {
+				case string, int, int64, uint64, float64, bool:
+				default:
+					continue outer
+				}
+
+				if seen[kv] {
+					continue outer
+				}
+
+				seen[kv] = true
 			}
 		}
 
-		v1Map, ok := v1.(map[string]any)
-		if ok {
-			del := map[string]any{
-				"$delete": maps.Clone(v1Map),
+		return k
+	}
+
+	return ""
+}
+
+func identityKeyRank(k string) int {
+	rank := slices.Index([]string{"name", "id", "key"}, k)
+	if rank == -1 {
+		return 3
+	}
+
+	return rank
+}
+
+// lcs returns the index pairs of a longest common subsequence of a and b.
+func lcs(a, b []string) [][2]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
 			}
-			ret = append(ret, del)
-		} else {
-			dst = slices.Clone(dst)
-			dst = append(dst, map[string]any{"$replace": true})
-			return dst, nil
 		}
 	}
 
-	if len(ret) == 0 {
-		return nil, nil
+	ret := [][2]int{}
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			ret = append(ret, [2]int{i, j})
+			i++
+			j++
+
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+
+		default:
+			j++
+		}
 	}
 
-	return ret, nil
+	return ret
+}
+
+// verifyDiff checks that merging patch into src gives dst.
+func verifyDiff(src, dst, patch any) error {
+	if patch == nil {
+		if reflect.DeepEqual(src, dst) {
+			return nil
+		}
+
+		return errors.ErrDiffMismatch
+	}
+
+	srcClone, err := utils.DeepClone(src)
+	if err != nil {
+		return err
+	}
+
+	patchClone, err := utils.DeepClone(patch)
+	if err != nil {
+		return err
+	}
+
+	doc := document.NewWithData("src", srcClone)
+
+	err = process.MergeDocs(doc, document.NewWithData("patch", patchClone))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.ErrDiffMismatch, err)
+	}
+
+	if !reflect.DeepEqual(doc.Data, dst) {
+		return errors.ErrDiffMismatch
+	}
+
+	return nil
 }
 
-func evaluateSelectors(doc *document.Document, selectors []string) (string, error) {
+// selectorKey returns the values at selectors in data, joined by "|".
+func selectorKey(data any, selectors []string) string {
 	if len(selectors) == 0 {
-		return "", nil
+		return ""
 	}
 
 	var keyParts []string
 	for _, selector := range selectors {
 		parts := pathutil.SplitPath(selector)
-		val, err := pathutil.Get(doc.Data, parts)
+		val, err := pathutil.Get(data, parts)
 		if err != nil {
 			keyParts = append(keyParts, "")
 		} else {
 			keyParts = append(keyParts, fmt.Sprint(val))
 		}
 	}
-	return strings.Join(keyParts, "|"), nil
+	return strings.Join(keyParts, "|")
 }
 
 func buildMatchValue(data any, selectors []string) map[string]any {
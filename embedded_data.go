@@ -8,7 +8,7 @@ import (
 
 	"github.com/gopatchy/bkl/internal/format"
 	"github.com/pelletier/go-toml/v2"
-	"gopkg.in/yaml.v3"
+	"go.yaml.in/yaml/v3"
 )
 
 //go:embed tests.toml
@@ -51,24 +51,38 @@ type DocExample struct {
 	Convert     *DocConvert   `yaml:"convert,omitempty" json:"convert,omitempty" toml:"convert,omitempty"`
 	Fixit       *DocFixit     `yaml:"fixit,omitempty" json:"fixit,omitempty" toml:"fixit,omitempty"`
 	Compare     *DocCompare   `yaml:"compare,omitempty" json:"compare,omitempty" toml:"compare,omitempty"`
+	Format      *DocFormat    `yaml:"format,omitempty" json:"format,omitempty" toml:"format,omitempty"`
+	Lint        *DocLint      `yaml:"lint,omitempty" json:"lint,omitempty" toml:"lint,omitempty"`
+	Refactor    *DocRefactor  `yaml:"refactor,omitempty" json:"refactor,omitempty" toml:"refactor,omitempty"`
+	Encrypt     *DocEncrypt   `yaml:"encrypt,omitempty" json:"encrypt,omitempty" toml:"encrypt,omitempty"`
 	Benchmark   bool          `toml:"benchmark,omitempty" json:"benchmark,omitempty" yaml:"benchmark,omitempty"`
 }
 
 type DocEvaluate struct {
-	Inputs []*DocLayer       `yaml:"inputs" json:"inputs" toml:"inputs"`
-	Result DocLayer          `yaml:"result" json:"result" toml:"result"`
-	Env    map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
-	Errors []string          `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
-	Root   string            `yaml:"root,omitempty" json:"root,omitempty" toml:"root,omitempty"`
-	Sort   []string          `yaml:"sort,omitempty" json:"sort,omitempty" toml:"sort,omitempty"`
+	Inputs       []*DocLayer       `yaml:"inputs" json:"inputs" toml:"inputs"`
+	Result       DocLayer          `yaml:"result" json:"result" toml:"result"`
+	Env          map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+	Errors       []string          `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
+	Root         string            `yaml:"root,omitempty" json:"root,omitempty" toml:"root,omitempty"`
+	Sort         []string          `yaml:"sort,omitempty" json:"sort,omitempty" toml:"sort,omitempty"`
+	Query        string            `yaml:"query,omitempty" json:"query,omitempty" toml:"query,omitempty"`
+	InferSchema  bool              `yaml:"infer_schema,omitempty" json:"infer_schema,omitempty" toml:"infer_schema,omitempty"`
+	Stream       bool              `yaml:"stream,omitempty" json:"stream,omitempty" toml:"stream,omitempty"`
+	Options      *FormatOptions    `yaml:"options,omitempty" json:"options,omitempty" toml:"options,omitempty"`
+	OutputDir    bool              `yaml:"output_dir,omitempty" json:"output_dir,omitempty" toml:"output_dir,omitempty"`
+	FileTemplate string            `yaml:"file_template,omitempty" json:"file_template,omitempty" toml:"file_template,omitempty"`
+	Outputs      []*DocLayer       `yaml:"outputs,omitempty" json:"outputs,omitempty" toml:"outputs,omitempty"`
+	Redacted     *DocLayer         `yaml:"redacted,omitempty" json:"redacted,omitempty" toml:"redacted,omitempty"`
 }
 
 type DocDiff struct {
-	Base     DocLayer `yaml:"base" json:"base" toml:"base"`
-	Target   DocLayer `yaml:"target" json:"target" toml:"target"`
-	Result   DocLayer `yaml:"result" json:"result" toml:"result"`
-	Selector []string `yaml:"selector,omitempty" json:"selector,omitempty" toml:"selector,omitempty"`
-	Errors   []string `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
+	Base     DocLayer    `yaml:"base" json:"base" toml:"base"`
+	Bases    []*DocLayer `yaml:"bases,omitempty" json:"bases,omitempty" toml:"bases,omitempty"`
+	Target   DocLayer    `yaml:"target" json:"target" toml:"target"`
+	Result   DocLayer    `yaml:"result" json:"result" toml:"result"`
+	Selector []string    `yaml:"selector,omitempty" json:"selector,omitempty" toml:"selector,omitempty"`
+	Redact   []string    `yaml:"redact,omitempty" json:"redact,omitempty" toml:"redact,omitempty"`
+	Errors   []string    `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
 }
 
 type DocIntersect struct {
@@ -98,11 +112,46 @@ type DocFixit struct {
 }
 
 type DocCompare struct {
-	Left   DocLayer          `yaml:"left" json:"left" toml:"left"`
-	Right  DocLayer          `yaml:"right" json:"right" toml:"right"`
-	Result DocLayer          `yaml:"result" json:"result" toml:"result"`
+	Left     DocLayer          `yaml:"left" json:"left" toml:"left"`
+	Right    DocLayer          `yaml:"right" json:"right" toml:"right"`
+	Result   DocLayer          `yaml:"result" json:"result" toml:"result"`
+	Env      map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+	Sort     []string          `yaml:"sort,omitempty" json:"sort,omitempty" toml:"sort,omitempty"`
+	Redact   []string          `yaml:"redact,omitempty" json:"redact,omitempty" toml:"redact,omitempty"`
+	Selector []string          `yaml:"selector,omitempty" json:"selector,omitempty" toml:"selector,omitempty"`
+	Changes  string            `yaml:"changes,omitempty" json:"changes,omitempty" toml:"changes,omitempty"`
+}
+
+type DocFormat struct {
+	Input  DocLayer `yaml:"input" json:"input" toml:"input"`
+	Result DocLayer `yaml:"result" json:"result" toml:"result"`
+	Errors []string `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
+}
+
+type DocLint struct {
+	Inputs  []*DocLayer       `yaml:"inputs" json:"inputs" toml:"inputs"`
+	Result  DocLayer          `yaml:"result" json:"result" toml:"result"`
+	Pattern string            `yaml:"pattern,omitempty" json:"pattern,omitempty" toml:"pattern,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
+	SARIF   bool              `yaml:"sarif,omitempty" json:"sarif,omitempty" toml:"sarif,omitempty"`
+}
+
+type DocRefactor struct {
+	Inputs   []*DocLayer `yaml:"inputs" json:"inputs" toml:"inputs"`
+	Into     string      `yaml:"into" json:"into" toml:"into"`
+	Outputs  []*DocLayer `yaml:"outputs,omitempty" json:"outputs,omitempty" toml:"outputs,omitempty"`
+	Selector []string    `yaml:"selector,omitempty" json:"selector,omitempty" toml:"selector,omitempty"`
+	Errors   []string    `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
+}
+
+// DocEncrypt encrypts the value at Path in the last input, then evaluates the
+// encrypted file, since the ciphertext itself differs on every run.
+type DocEncrypt struct {
+	Inputs []*DocLayer       `yaml:"inputs" json:"inputs" toml:"inputs"`
+	Path   string            `yaml:"path" json:"path" toml:"path"`
 	Env    map[string]string `yaml:"env,omitempty" json:"env,omitempty" toml:"env,omitempty"`
-	Sort   []string          `yaml:"sort,omitempty" json:"sort,omitempty" toml:"sort,omitempty"`
+	Result DocLayer          `yaml:"result" json:"result" toml:"result"`
+	Errors []string          `yaml:"errors,omitempty" json:"errors,omitempty" toml:"errors,omitempty"`
 }
 
 type DocLayer struct {
@@ -275,6 +324,11 @@ func (dd *DocDiff) ConvertCodeBlocks(targetFormat string) bool {
 	if dd.Base.ConvertCodeBlocks(targetFormat) {
 		converted = true
 	}
+	for _, base := range dd.Bases {
+		if base.ConvertCodeBlocks(targetFormat) {
+			converted = true
+		}
+	}
 	if dd.Target.ConvertCodeBlocks(targetFormat) {
 		converted = true
 	}
@@ -484,6 +538,9 @@ func (dd *DocDiff) Score(keywords []string) int {
 
 	score := 0
 	score += dd.Base.Score(keywords)
+	for _, base := range dd.Bases {
+		score += base.Score(keywords)
+	}
 	score += dd.Target.Score(keywords)
 	score += dd.Result.Score(keywords)
 
@@ -0,0 +1,204 @@
+package bkl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/secret"
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Encrypt returns the layer file at path with the value at keyPath (e.g.
+// "db.password") replaced, in every document that has it, by
+// {$decode: method, $value: <ciphertext>}, which evaluates back to the value.
+// method is "age" or "pgp". recipients are age public keys (age1...) or
+// armored PGP public keys; if there are none, it encrypts to the private key
+// that $decode would use (BKL_AGE_KEY, BKL_PGP_KEY, etc.). Only strings can
+// be encrypted, since $decode returns one. YAML keeps its comments; other
+// formats are re-encoded.
+// If env is nil, it uses the current OS environment.
+func Encrypt(fx fs.FS, path string, rootPath string, workingDir string, keyPath string, method string, recipients []string, env map[string]string) ([]byte, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	preparedPaths, err := utils.PreparePathsForParser([]string{path}, rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSystem := fsys.New(fx)
+
+	data, err := fs.ReadFile(fileSystem, preparedPaths[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	encrypt := func(plaintext string) (string, error) {
+		return secret.Encrypt(fileSystem, method, plaintext, recipients, func(name string) string { return env[name] })
+	}
+
+	parts := pathutil.SplitPath(keyPath)
+
+	switch utils.Ext(path) {
+	case "yaml", "yml":
+		return encryptYAML(data, parts, method, encrypt)
+
+	default:
+		return encryptDocs(data, utils.Ext(path), parts, method, encrypt)
+	}
+}
+
+func encryptYAML(data []byte, parts []string, method string, encrypt func(string) (string, error)) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	found := false
+
+	for {
+		node := &yaml.Node{}
+
+		err := dec.Decode(node)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		target := yamlFind(node.Content[0], parts)
+		if target != nil {
+			if target.Kind != yaml.ScalarNode || target.ShortTag() != "!!str" {
+				return nil, fmt.Errorf("%v: only strings can be encrypted: %w", parts, errors.ErrInvalidType)
+			}
+
+			ciphertext, err := encrypt(target.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			*target = yaml.Node{
+				Kind:        yaml.MappingNode,
+				Tag:         "!!map",
+				HeadComment: target.HeadComment,
+				FootComment: target.FootComment,
+				Content: []*yaml.Node{
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: "$decode"},
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: method, LineComment: target.LineComment},
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: "$value"},
+					{Kind: yaml.ScalarNode, Tag: "!!str", Value: ciphertext, Style: yaml.LiteralStyle},
+				},
+			}
+
+			found = true
+		}
+
+		err = enc.Encode(node)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrMarshal)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%v: %w", parts, errors.ErrRefNotFound)
+	}
+
+	err := enc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// yamlFind returns the node at parts under node, or nil.
+func yamlFind(node *yaml.Node, parts []string) *yaml.Node {
+	if len(parts) == 0 {
+		return node
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == parts[0] {
+				return yamlFind(node.Content[i+1], parts[1:])
+			}
+		}
+
+	case yaml.SequenceNode:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil
+		}
+
+		if idx < 0 {
+			idx += len(node.Content)
+		}
+
+		if idx >= 0 && idx < len(node.Content) {
+			return yamlFind(node.Content[idx], parts[1:])
+		}
+	}
+
+	return nil
+}
+
+func encryptDocs(data []byte, formatName string, parts []string, method string, encrypt func(string) (string, error)) ([]byte, error) {
+	ft, err := format.Get(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := ft.UnmarshalStream(data)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+
+	for _, doc := range docs {
+		m, ok := doc.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		v, err := pathutil.Get(m, parts)
+		if err != nil {
+			continue
+		}
+
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v: only strings can be encrypted: %w", parts, errors.ErrInvalidType)
+		}
+
+		ciphertext, err := encrypt(s)
+		if err != nil {
+			return nil, err
+		}
+
+		pathutil.Set(m, parts, map[string]any{
+			"$decode": method,
+			"$value":  ciphertext,
+		})
+
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%v: %w", parts, errors.ErrRefNotFound)
+	}
+
+	return ft.MarshalStream(docs)
+}
@@ -27,6 +27,7 @@ import (
 // Phase 1
 //   - $parent
 //   - $defer (marks document for deferred processing)
+//   - $sensitive (records the value's path for redaction)
 //
 // Phase 2
 //   - $delete
@@ -50,6 +51,7 @@ import (
 //
 // Phase 6
 //   - $output
+//   - $file
 //
 // After all phases, documents marked with $defer are applied to the output.
 //
@@ -70,21 +72,44 @@ import (
 // If format is nil, it infers the format from the paths parameter (output path first, then input files).
 // If env is nil, it uses the current OS environment.
 func Evaluate(fx fs.FS, files []string, rootPath string, workingDir string, env map[string]string, format *string, sort []string, paths ...*string) ([]byte, error) {
+	return EvaluateWithOptions(fx, files, rootPath, workingDir, env, format, nil, sort, paths...)
+}
+
+// EvaluateWithOptions is Evaluate with Options for the output. If opts is
+// nil, it behaves like Evaluate.
+func EvaluateWithOptions(fx fs.FS, files []string, rootPath string, workingDir string, env map[string]string, format *string, opts *Options, sort []string, paths ...*string) ([]byte, error) {
 	if env == nil {
 		env = getOSEnv()
 	}
 
-	evalFiles, err := utils.PreparePathsForParser(files, rootPath, workingDir)
+	realFiles, inferredFormat, err := resolveFiles(fx, files, rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	allPaths := append(paths, &inferredFormat)
+	ft, err := determineFormat(format, opts.format(), allPaths...)
 	if err != nil {
 		return nil, err
 	}
 
+	return merge.Files(fx, realFiles, ft, env, sort, opts.redact())
+}
+
+// resolveFiles maps input paths to real files and returns the format of the
+// first one.
+func resolveFiles(fx fs.FS, files []string, rootPath string, workingDir string) ([]string, string, error) {
+	evalFiles, err := utils.PreparePathsForParser(files, rootPath, workingDir)
+	if err != nil {
+		return nil, "", err
+	}
+
 	realFiles := make([]string, len(evalFiles))
 	var inferredFormat string
 	for i, path := range evalFiles {
 		realPath, fileFormat, err := file.FileMatch(fx, path)
 		if err != nil {
-			return nil, fmt.Errorf("file %s: %w", path, err)
+			return nil, "", fmt.Errorf("file %s: %w", path, err)
 		}
 		realFiles[i] = realPath
 
@@ -93,30 +118,56 @@ func Evaluate(fx fs.FS, files []string, rootPath string, workingDir string, env
 		}
 	}
 
-	allPaths := append(paths, &inferredFormat)
-	ft, err := determineFormat(format, allPaths...)
-	if err != nil {
-		return nil, err
-	}
-
-	return merge.Files(fx, realFiles, ft, env, sort)
+	return realFiles, inferredFormat, nil
 }
 
 func EvaluateTree(fx fs.FS, directory string, pattern string, env map[string]string, format *string) ([]TreeResult, error) {
+	return EvaluateTreeWithOptions(fx, directory, pattern, env, format, nil)
+}
+
+// EvaluateTreeWithOptions is EvaluateTree with Options for the outputs. If
+// opts is nil, it behaves like EvaluateTree.
+func EvaluateTreeWithOptions(fx fs.FS, directory string, pattern string, env map[string]string, format *string, opts *Options) ([]TreeResult, error) {
 	if env == nil {
 		env = getOSEnv()
 	}
 
 	var results []TreeResult
 
+	err := walkTree(fx, directory, pattern, func(path string, err error) {
+		if err != nil {
+			results = append(results, TreeResult{
+				Path:  path,
+				Error: err,
+			})
+			return
+		}
+
+		output, err := EvaluateWithOptions(fx, []string{path}, "/", "/", env, format, opts, nil, &path)
+		results = append(results, TreeResult{
+			Path:   path,
+			Error:  err,
+			Output: string(output),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// walkTree calls fn with the absolute path of each file under directory
+// whose base name matches pattern (all files if pattern is empty).
+func walkTree(fx fs.FS, directory string, pattern string, fn func(string, error)) error {
 	walkDir := strings.TrimPrefix(directory, "/")
+	if walkDir == "" {
+		walkDir = "."
+	}
 
 	err := fs.WalkDir(fx, walkDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			results = append(results, TreeResult{
-				Path:  "/" + path,
-				Error: fmt.Errorf("failed to access: %w", err),
-			})
+			fn("/"+path, fmt.Errorf("failed to access: %w", err))
 			return nil
 		}
 
@@ -133,20 +184,15 @@ func EvaluateTree(fx fs.FS, directory string, pattern string, env map[string]str
 			}
 		}
 
-		output, err := Evaluate(fx, []string{fullPath}, "/", "/", env, format, nil, &fullPath)
-		results = append(results, TreeResult{
-			Path:   fullPath,
-			Error:  err,
-			Output: string(output),
-		})
+		fn(fullPath, nil)
 
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk directory: %w", err)
+		return fmt.Errorf("failed to walk directory: %w", err)
 	}
 
-	return results, nil
+	return nil
 }
 
 type TreeResult struct {
@@ -0,0 +1,70 @@
+package bkl
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/utils"
+)
+
+// FileResult is one output file from EvaluateFiles.
+type FileResult struct {
+	Path   string
+	Output []byte
+}
+
+// EvaluateFiles processes the specified files like Evaluate, but routes each
+// output document to a file: the path in its $file directive or, if it has
+// none, template. {path} in either is replaced by that value from the
+// document, e.g. "{metadata.name}.yaml". Documents with the same file name
+// are written to one file, in order. Each file's format comes from its
+// extension, or the format inferred as in Evaluate if it has none.
+// If env is nil, it uses the current OS environment.
+// If opts is nil, it uses each format's default style.
+func EvaluateFiles(fx fs.FS, files []string, rootPath string, workingDir string, env map[string]string, format *string, opts *Options, template string, sort []string, paths ...*string) ([]FileResult, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	realFiles, inferredFormat, err := resolveFiles(fx, files, rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	allPaths := append(paths, &inferredFormat)
+	defaultFormat, err := determineFormat(format, opts.format(), allPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	outFiles, err := merge.FileOutputs(fx, realFiles, env, opts.format(), sort, template)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []FileResult{}
+
+	for _, f := range outFiles {
+		ft := defaultFormat
+
+		if ext := utils.Ext(f.Path); ext != "" {
+			ft, err = determineFormat(&ext, opts.format())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Path, err)
+			}
+		}
+
+		output, err := ft.MarshalStream(f.Docs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+
+		ret = append(ret, FileResult{
+			Path:   f.Path,
+			Output: output,
+		})
+	}
+
+	return ret, nil
+}
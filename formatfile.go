@@ -0,0 +1,34 @@
+package bkl
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/gopatchy/bkl/internal/canonical"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/utils"
+)
+
+// FormatFile returns the layer file at path in canonical form: consistent
+// indentation, $parent, $match and $output first in each map, $"..."
+// strings with minimal quoting and --- between documents. It works on the
+// source, not the evaluated output, and keeps comments. YAML, JSON and TOML
+// files are supported.
+func FormatFile(fx fs.FS, path string, rootPath string, workingDir string) ([]byte, error) {
+	preparedPaths, err := utils.PreparePathsForParser([]string{path}, rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(fsys.New(fx), preparedPaths[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	out, err := canonical.Format(data, utils.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return out, nil
+}
@@ -10,7 +10,13 @@ import (
 // and uses the file extension of the first non-nil path as the format.
 // Returns the marshaled bytes or an error if the format is unknown or marshaling fails.
 func FormatOutput(data any, format *string, paths ...*string) ([]byte, error) {
-	ft, err := determineFormat(format, paths...)
+	return FormatOutputWithOptions(data, format, nil, paths...)
+}
+
+// FormatOutputWithOptions is FormatOutput with Options for the output. If
+// opts is nil, it behaves like FormatOutput.
+func FormatOutputWithOptions(data any, format *string, opts *Options, paths ...*string) ([]byte, error) {
+	ft, err := determineFormat(format, opts.format(), paths...)
 	if err != nil {
 		return nil, err
 	}
@@ -18,18 +24,38 @@ func FormatOutput(data any, format *string, paths ...*string) ([]byte, error) {
 	return ft.MarshalStream([]any{data})
 }
 
-func determineFormat(formatName *string, paths ...*string) (*format.Format, error) {
-	if formatName != nil && *formatName != "" {
-		return format.Get(*formatName)
-	}
+// FormatOptions control how output is written: indentation, YAML sequence
+// indentation, string quoting and folding, and the final newline. They also
+// set whether custom YAML tags (!Ref, !Sub, !GetAtt) on input values are kept
+// and written back out, rather than rejected. The zero value is each format's
+// default style.
+type FormatOptions = format.Options
+
+// determineFormat returns the format named by formatName or, failing that,
+// the extension of the first path that has one, with opts if non-nil.
+func determineFormat(formatName *string, opts *FormatOptions, paths ...*string) (*format.Format, error) {
+	name := ""
 
-	for _, path := range paths {
-		if path != nil && *path != "" {
-			if name := utils.Ext(*path); name != "" {
-				return format.Get(name)
+	if formatName != nil && *formatName != "" {
+		name = *formatName
+	} else {
+		for _, path := range paths {
+			if path != nil && *path != "" {
+				if name = utils.Ext(*path); name != "" {
+					break
+				}
 			}
 		}
 	}
 
-	return format.Get("")
+	ft, err := format.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts != nil {
+		ft.Options = *opts
+	}
+
+	return ft, nil
 }
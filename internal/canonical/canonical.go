@@ -0,0 +1,47 @@
+// Package canonical rewrites bkl layer files in a canonical form: consistent
+// indentation, $parent, $match and $output first in each map, $"..." strings
+// with minimal quoting and --- between documents. Comments are kept.
+package canonical
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Directive keys that go first in a map, in this order.
+var firstKeys = []string{"$parent", "$match", "$output"}
+
+// Format returns data, a layer file in formatName (yaml, yml, json or toml),
+// in canonical form.
+func Format(data []byte, formatName string) ([]byte, error) {
+	switch formatName {
+	case "yaml", "yml":
+		return formatYAML(data)
+
+	case "json":
+		return formatJSON(data)
+
+	case "toml":
+		return formatTOML(data)
+
+	default:
+		return nil, fmt.Errorf("%s: only yaml, json and toml can be formatted: %w", formatName, errors.ErrUnknownFormat)
+	}
+}
+
+// keyRank orders map keys: firstKeys in order, then everything else.
+func keyRank(key string) int {
+	i := slices.Index(firstKeys, key)
+	if i == -1 {
+		return len(firstKeys)
+	}
+
+	return i
+}
+
+func isInterpolation(s string) bool {
+	return strings.HasPrefix(s, `$"`) && strings.HasSuffix(s, `"`) && len(s) >= 3
+}
@@ -0,0 +1,186 @@
+package canonical
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// jsonValue is a parsed JSON value that keeps key order and number text.
+type jsonValue struct {
+	// Encoded scalar, or "" for objects and arrays.
+	raw    string
+	object bool
+	keys   []string
+	values []*jsonValue
+}
+
+func formatJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	buf := &bytes.Buffer{}
+
+	for {
+		v, err := readJSON(dec)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		err = writeJSON(buf, v, "")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrMarshal)
+		}
+
+		buf.WriteString("\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func readJSON(dec *json.Decoder) (*jsonValue, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		v := &jsonValue{object: t == '{'}
+
+		for dec.More() {
+			if v.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				v.keys = append(v.keys, key.(string))
+			}
+
+			child, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			v.values = append(v.values, child)
+		}
+
+		// Closing delimiter
+		_, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		if v.object {
+			sortJSONKeys(v)
+		}
+
+		return v, nil
+
+	case nil:
+		return &jsonValue{raw: "null"}, nil
+
+	case json.Number:
+		return &jsonValue{raw: t.String()}, nil
+
+	default:
+		raw, err := encodeJSONScalar(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return &jsonValue{raw: raw}, nil
+	}
+}
+
+func sortJSONKeys(v *jsonValue) {
+	idx := make([]int, len(v.keys))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	slices.SortStableFunc(idx, func(a, b int) int {
+		return keyRank(v.keys[a]) - keyRank(v.keys[b])
+	})
+
+	keys := make([]string, len(idx))
+	values := make([]*jsonValue, len(idx))
+
+	for i, j := range idx {
+		keys[i] = v.keys[j]
+		values[i] = v.values[j]
+	}
+
+	v.keys = keys
+	v.values = values
+}
+
+func encodeJSONScalar(v any) (string, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(v)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+func writeJSON(buf *bytes.Buffer, v *jsonValue, indent string) error {
+	if v.raw != "" {
+		buf.WriteString(v.raw)
+		return nil
+	}
+
+	openDelim, closeDelim := "[", "]"
+	if v.object {
+		openDelim, closeDelim = "{", "}"
+	}
+
+	if len(v.values) == 0 {
+		buf.WriteString(openDelim + closeDelim)
+		return nil
+	}
+
+	buf.WriteString(openDelim + "\n")
+
+	for i, child := range v.values {
+		buf.WriteString(indent + "  ")
+
+		if v.object {
+			key, err := encodeJSONScalar(v.keys[i])
+			if err != nil {
+				return err
+			}
+
+			buf.WriteString(key + ": ")
+		}
+
+		err := writeJSON(buf, child, indent+"  ")
+		if err != nil {
+			return err
+		}
+
+		if i < len(v.values)-1 {
+			buf.WriteString(",")
+		}
+
+		buf.WriteString("\n")
+	}
+
+	buf.WriteString(indent + closeDelim)
+
+	return nil
+}
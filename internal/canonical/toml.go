@@ -0,0 +1,272 @@
+package canonical
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Same document separators as the toml format.
+var tomlDocRE = regexp.MustCompile(`(?m)^(\+\+\+|---)$`)
+
+// tomlBlock is a key/value or table header and the comments and blank lines
+// before it.
+type tomlBlock struct {
+	lines []string
+	rank  int
+}
+
+// tomlSection is an optional table header and its key/values, which are
+// sorted within the section. A comment block that the first key/value doesn't
+// follow directly stays at the top of the section.
+type tomlSection struct {
+	header *tomlBlock
+	lead   []string
+	blocks []*tomlBlock
+}
+
+func formatTOML(data []byte) ([]byte, error) {
+	docs := []string{}
+
+	for _, part := range tomlDocRE.Split(string(data), -1) {
+		var obj any
+
+		err := toml.Unmarshal([]byte(part), &obj)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		doc, err := formatTOMLDoc(part)
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+func formatTOMLDoc(text string) (string, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	sections := []*tomlSection{{}}
+	pending := []string{}
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case trimmed == "":
+			pending = append(pending, "")
+
+		case strings.HasPrefix(trimmed, "#"):
+			pending = append(pending, trimmed)
+
+		case strings.HasPrefix(trimmed, "["):
+			sections = append(sections, &tomlSection{
+				header: &tomlBlock{lines: append(pending, trimmed)},
+			})
+			pending = []string{}
+
+		default:
+			end, block, err := tomlStatement(lines, i)
+			if err != nil {
+				return "", err
+			}
+
+			section := sections[len(sections)-1]
+
+			lead := 0
+			if len(section.blocks) == 0 {
+				lead = tomlLead(pending)
+			}
+
+			section.lead = append(section.lead, pending[:lead]...)
+			block.lines = append(pending[lead:], block.lines...)
+
+			pending = []string{}
+
+			section.blocks = append(section.blocks, block)
+
+			i = end
+		}
+	}
+
+	out := []string{}
+
+	add := func(lines ...string) {
+		for _, line := range lines {
+			if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+				continue
+			}
+
+			out = append(out, line)
+		}
+	}
+
+	for _, section := range sections {
+		if section.header != nil {
+			add("")
+			add(section.header.lines...)
+		}
+
+		add(section.lead...)
+
+		slices.SortStableFunc(section.blocks, func(a, b *tomlBlock) int {
+			return a.rank - b.rank
+		})
+
+		for _, block := range section.blocks {
+			add(block.lines...)
+		}
+	}
+
+	add(pending...)
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// tomlLead returns the number of lines before the first key/value of a
+// section that aren't attached to it: up to its last blank line.
+func tomlLead(pending []string) int {
+	for i := len(pending) - 1; i >= 0; i-- {
+		if pending[i] == "" {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// tomlStatement returns the key/value that starts at lines[start], in
+// canonical form, and the index of its last line.
+func tomlStatement(lines []string, start int) (int, *tomlBlock, error) {
+	for end := start; end < len(lines); end++ {
+		obj := map[string]any{}
+
+		err := toml.Unmarshal([]byte(strings.Join(lines[start:end+1], "\n")), &obj)
+		if err != nil {
+			continue
+		}
+
+		block := &tomlBlock{
+			lines: append([]string{}, lines[start:end+1]...),
+			rank:  len(firstKeys),
+		}
+
+		key, rest, found := splitTOMLKey(strings.TrimSpace(lines[start]))
+		if !found {
+			return end, block, nil
+		}
+
+		for k, v := range obj {
+			block.rank = keyRank(k)
+
+			if end > start {
+				break
+			}
+
+			if k == unquoteTOMLKey(key) && isInterpolation(k) {
+				key = quoteTOML(k)
+			}
+
+			if s, ok := v.(string); ok && isInterpolation(s) {
+				rest = quoteTOML(s) + tomlComment(key, rest)
+			}
+		}
+
+		block.lines[0] = key + " = " + rest
+
+		if end == start {
+			block.lines[0] = strings.TrimRightFunc(block.lines[0], unicode.IsSpace)
+		}
+
+		return end, block, nil
+	}
+
+	return 0, nil, fmt.Errorf("line %d: incomplete key/value: %w", start+1, errors.ErrUnmarshal)
+}
+
+// splitTOMLKey splits "key = value" at the first = outside quotes.
+func splitTOMLKey(s string) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+
+		case '\'':
+			for i++; i < len(s) && s[i] != '\''; i++ {
+			}
+
+		case '=':
+			return strings.TrimSpace(s[:i]), strings.TrimLeftFunc(s[i+1:], unicode.IsSpace), true
+		}
+	}
+
+	return "", "", false
+}
+
+// unquoteTOMLKey returns a simple key's name, or "" for dotted keys.
+func unquoteTOMLKey(key string) string {
+	obj := map[string]any{}
+
+	err := toml.Unmarshal([]byte(key+" = 0"), &obj)
+	if err != nil || len(obj) != 1 {
+		return ""
+	}
+
+	for k, v := range obj {
+		if _, nested := v.(map[string]any); !nested {
+			return k
+		}
+	}
+
+	return ""
+}
+
+// tomlComment returns the comment after the value in rest, if any, with a
+// leading space.
+func tomlComment(key string, rest string) string {
+	for i := range len(rest) {
+		if rest[i] != '#' {
+			continue
+		}
+
+		err := toml.Unmarshal([]byte(key+" = "+rest[:i]), &map[string]any{})
+		if err == nil {
+			return " " + strings.TrimSpace(rest[i:])
+		}
+	}
+
+	return ""
+}
+
+// quoteTOML returns s as a literal string if it can be one, else as a basic
+// string.
+func quoteTOML(s string) string {
+	if !strings.ContainsFunc(s, func(r rune) bool { return r == '\'' || unicode.IsControl(r) }) {
+		return "'" + s + "'"
+	}
+
+	quoted, _ := encodeJSONScalar(s)
+
+	return quoted
+}
@@ -0,0 +1,94 @@
+package canonical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+func formatYAML(data []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	docs := []string{}
+
+	for {
+		node := &yaml.Node{}
+
+		err := dec.Decode(node)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		canonicalNode(node)
+
+		// Documents are encoded one at a time so an empty one is written as
+		// nothing between its separators, not a blank line
+		buf := &bytes.Buffer{}
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(2)
+
+		err = enc.Encode(node)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrMarshal)
+		}
+
+		err = enc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, strings.TrimLeft(buf.String(), "\n"))
+	}
+
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+// canonicalNode sorts directive keys first, lets the encoder choose the
+// quoting of $"..." strings and drops the !!merge tag of << keys, recursively.
+func canonicalNode(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		pairs := [][2]*yaml.Node{}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+		}
+
+		if len(pairs) == 0 {
+			break
+		}
+
+		slices.SortStableFunc(pairs, func(a, b [2]*yaml.Node) int {
+			return keyRank(a[0].Value) - keyRank(b[0].Value)
+		})
+
+		node.Content = node.Content[:0]
+
+		for _, pair := range pairs {
+			node.Content = append(node.Content, pair[0], pair[1])
+		}
+
+	case yaml.ScalarNode:
+		// The encoder writes the tag of a merge key, which is implied by <<
+		if node.Tag == "!!merge" {
+			node.Tag = ""
+		}
+
+		if node.Tag == "!!str" && isInterpolation(node.Value) {
+			node.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+		}
+	}
+
+	for _, child := range node.Content {
+		canonicalNode(child)
+	}
+}
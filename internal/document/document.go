@@ -3,6 +3,7 @@ package document
 import (
 	"fmt"
 
+	"github.com/gopatchy/bkl/internal/redact"
 	"github.com/gopatchy/bkl/internal/utils"
 )
 
@@ -10,11 +11,15 @@ type Document struct {
 	ID      string
 	Parents []*Document
 	Data    any
+
+	// Sensitive is the paths in Data of values to redact.
+	Sensitive *redact.Set
 }
 
 func New(id string) *Document {
 	return &Document{
-		ID: id,
+		ID:        id,
+		Sensitive: &redact.Set{},
 	}
 }
 
@@ -47,6 +52,7 @@ func (d *Document) Clone(suffix string) (*Document, error) {
 	}
 
 	d2 := NewWithData(fmt.Sprintf("%s|%s", d, suffix), data)
+	d2.Sensitive = d.Sensitive.Clone()
 
 	for _, parent := range d.Parents {
 		d2.Parents = append(d2.Parents, parent)
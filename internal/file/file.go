@@ -14,6 +14,8 @@ import (
 	"github.com/gopatchy/bkl/internal/fsys"
 	"github.com/gopatchy/bkl/internal/normalize"
 	"github.com/gopatchy/bkl/internal/process"
+	"github.com/gopatchy/bkl/internal/redact"
+	"github.com/gopatchy/bkl/internal/secret"
 	"github.com/gopatchy/bkl/internal/utils"
 	"github.com/gopatchy/bkl/pkg/errors"
 )
@@ -25,7 +27,9 @@ type File struct {
 	Docs  []*document.Document
 }
 
-func Load(fsys *fsys.FS, path string, child *File) (*File, error) {
+// Load reads and normalizes the documents of path. opts may be nil for the
+// default Options.
+func Load(fsys *fsys.FS, path string, child *File, env map[string]string, opts *format.Options) (*File, error) {
 	expr, err := parseMatchExpression(path)
 	if err != nil {
 		return nil, err
@@ -40,24 +44,17 @@ func Load(fsys *fsys.FS, path string, child *File) (*File, error) {
 		f.ID = fmt.Sprintf("%s|%s", child.ID, f.ID)
 	}
 
-	ft, err := format.Get(utils.Ext(expr.filename))
+	ft, err := getFormat(utils.Ext(expr.filename), opts)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", expr.filename, err)
 	}
 
-	var fh io.ReadCloser
-
-	if utils.IsStdin(expr.filename) {
-		fh = os.Stdin
+	fh, err := open(fsys, expr.filename)
+	if err != nil {
+		return nil, err
 	}
-	if fh == nil {
-		fh, err = fsys.Open(expr.filename)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", expr.filename, err)
-		}
 
-		defer fh.Close()
-	}
+	defer fh.Close()
 
 	raw, err := io.ReadAll(fh)
 	if err != nil {
@@ -69,19 +66,30 @@ func Load(fsys *fsys.FS, path string, child *File) (*File, error) {
 		return nil, fmt.Errorf("%s: %w", expr.filename, err)
 	}
 
-	for i, doc := range docs {
-		id := fmt.Sprintf("%s|doc%d", f, i)
+	decrypted := []*redact.Set{}
 
-		doc, err = normalize.Document(doc)
+	if len(docs) > 0 && secret.IsSOPS(docs[0]) {
+		docs, decrypted, err = decryptSOPS(fsys, raw, env, opts)
 		if err != nil {
-			return nil, fmt.Errorf("[%s]: %w", id, err)
+			return nil, fmt.Errorf("%s: %w", expr.filename, err)
 		}
+	}
 
-		docObj := document.NewWithData(id, doc)
+	for i, doc := range docs {
+		docObj, err := f.newDocument(i, doc, expr.match)
+		if err != nil {
+			return nil, err
+		}
 
-		if expr.match == nil || process.MatchDoc(docObj, expr.match) {
-			f.Docs = append(f.Docs, docObj)
+		if docObj == nil {
+			continue
 		}
+
+		if i < len(decrypted) {
+			docObj.Sensitive.Merge(decrypted[i])
+		}
+
+		f.Docs = append(f.Docs, docObj)
 	}
 
 	f.setParents()
@@ -89,16 +97,95 @@ func Load(fsys *fsys.FS, path string, child *File) (*File, error) {
 	return f, nil
 }
 
-func LoadAndParents(fsys *fsys.FS, path string, child *File) ([]*File, error) {
-	return loadFileAndParentsInt(fsys, path, child, []string{})
+// decryptSOPS returns the documents of a SOPS-encrypted file, decrypted with
+// the age keys in env, and the paths of the decrypted values in each.
+func decryptSOPS(fsys *fsys.FS, raw []byte, env map[string]string, opts *format.Options) ([]any, []*redact.Set, error) {
+	plain, decrypted, err := secret.DecryptSOPS(fsys, raw, func(name string) string { return env[name] })
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ft, err := getFormat("yaml", opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docs, err := ft.UnmarshalStream(plain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return docs, decrypted, nil
+}
+
+func getFormat(name string, opts *format.Options) (*format.Format, error) {
+	ft, err := format.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts != nil {
+		ft.Options = *opts
+	}
+
+	return ft, nil
+}
+
+func open(fsys *fsys.FS, filename string) (io.ReadCloser, error) {
+	if utils.IsStdin(filename) {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	fh, err := fsys.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return fh, nil
+}
+
+// newDocument normalizes the i'th document of the file, returning nil if it
+// doesn't match the file's match expression.
+func (f *File) newDocument(i int, doc any, match any) (*document.Document, error) {
+	id := fmt.Sprintf("%s|doc%d", f, i)
+
+	doc, err := normalize.Document(doc)
+	if err != nil {
+		return nil, fmt.Errorf("[%s]: %w", id, err)
+	}
+
+	doc, sensitive, err := redact.Extract(doc)
+	if err != nil {
+		return nil, fmt.Errorf("[%s]: %w", id, err)
+	}
+
+	docObj := document.NewWithData(id, doc)
+	docObj.Sensitive = sensitive
+
+	if match != nil {
+		ok, err := process.MatchDoc(docObj, match)
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %w", id, err)
+		}
+
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	return docObj, nil
+}
+
+func LoadAndParents(fsys *fsys.FS, path string, child *File, env map[string]string, opts *format.Options) ([]*File, error) {
+	return loadFileAndParentsInt(fsys, path, child, env, opts, []string{})
 }
 
-func loadFileAndParentsInt(fsys *fsys.FS, path string, child *File, stack []string) ([]*File, error) {
+func loadFileAndParentsInt(fsys *fsys.FS, path string, child *File, env map[string]string, opts *format.Options, stack []string) ([]*File, error) {
 	if slices.Contains(stack, path) {
 		return nil, fmt.Errorf("%s: %w", strings.Join(append(stack, path), " -> "), errors.ErrCircularRef)
 	}
 
-	f, err := Load(fsys, path, child)
+	f, err := Load(fsys, path, child, env, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +206,7 @@ func loadFileAndParentsInt(fsys *fsys.FS, path string, child *File, stack []stri
 			child2 = child
 		}
 
-		parentFiles, err := loadFileAndParentsInt(fsys, parent, child2, stack)
+		parentFiles, err := loadFileAndParentsInt(fsys, parent, child2, env, opts, stack)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/secret"
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Stream reads the documents of a file one at a time. Its File has no Docs;
+// documents from Next have the docs of the file's parent layers as parents.
+type Stream struct {
+	File *File
+
+	fh      io.ReadCloser
+	dec     format.Decoder
+	match   any
+	i       int
+	parents []*document.Document
+}
+
+func OpenStream(fsys *fsys.FS, path string, opts *format.Options) (*Stream, error) {
+	expr, err := parseMatchExpression(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ft, err := getFormat(utils.Ext(expr.filename), opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", expr.filename, err)
+	}
+
+	fh, err := open(fsys, expr.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := ft.NewDecoder(fh)
+	if dec == nil {
+		fh.Close()
+		return nil, fmt.Errorf("%s: %w", expr.filename, errors.ErrStreamUnsupported)
+	}
+
+	return &Stream{
+		File: &File{
+			ID:   expr.filename,
+			Path: expr.filename,
+		},
+		fh:    fh,
+		dec:   dec,
+		match: expr.match,
+	}, nil
+}
+
+// LoadParents loads the parent layers of the streamed file. Parents come
+// from the filename only, since $parent could appear in any document.
+func (s *Stream) LoadParents(fsys *fsys.FS, env map[string]string, opts *format.Options) ([]*File, error) {
+	parents, err := s.File.parentsFromFilename(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*File{}
+
+	for _, parent := range parents {
+		parentFiles, err := loadFileAndParentsInt(fsys, parent, s.File, env, opts, []string{s.File.Path})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range parentFiles {
+			if f.Child == s.File {
+				s.parents = append(s.parents, f.Docs...)
+			}
+		}
+
+		files = append(files, parentFiles...)
+	}
+
+	return files, nil
+}
+
+// Next returns the next document, or io.EOF after the last.
+func (s *Stream) Next() (*document.Document, error) {
+	for {
+		raw, err := s.dec.Decode()
+		if err == io.EOF {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %w", s.File.Path, err, errors.ErrUnmarshal)
+		}
+
+		if s.i == 0 && secret.IsSOPS(raw) {
+			return nil, fmt.Errorf("%s: sops encrypted: %w", s.File.Path, errors.ErrStreamUnsupported)
+		}
+
+		doc, err := s.File.newDocument(s.i, raw, s.match)
+		s.i++
+
+		if err != nil {
+			return nil, err
+		}
+
+		if doc == nil {
+			continue
+		}
+
+		doc.Parents = append(doc.Parents, s.parents...)
+
+		return doc, nil
+	}
+}
+
+func (s *Stream) Close() error {
+	return s.fh.Close()
+}
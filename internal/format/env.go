@@ -0,0 +1,160 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Dotenv files are flat KEY=VALUE maps. When reading, an optional "export "
+// prefix is ignored; single-quoted values are literal, double-quoted values
+// support \n, \t, \", \\ and \$ escapes, and unquoted values end at " #".
+// When writing, values that aren't plain words are single-quoted, or
+// double-quoted if they contain a single quote or newline.
+
+var (
+	envKeyRE   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	envPlainRE = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+)
+
+var (
+	envEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	envUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, `$`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+)
+
+func envMarshalStream(vs []any, _ *Options) ([]byte, error) {
+	if len(vs) != 1 {
+		return nil, fmt.Errorf("env format only supports single document: %w", errors.ErrMarshal)
+	}
+
+	obj, ok := vs[0].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("env requires top-level map, got %T: %w", vs[0], errors.ErrMarshal)
+	}
+
+	buf := &bytes.Buffer{}
+
+	for k, v := range utils.SortedMap(obj) {
+		if !envKeyRE.MatchString(k) {
+			return nil, fmt.Errorf("%q is not a valid env variable name: %w", k, errors.ErrMarshal)
+		}
+
+		var s string
+
+		switch v2 := v.(type) {
+		case nil:
+
+		case map[string]any, []any:
+			return nil, fmt.Errorf("%s: env values must be scalars, got %T: %w", k, v, errors.ErrMarshal)
+
+		default:
+			s = fmt.Sprint(v2)
+		}
+
+		fmt.Fprintf(buf, "%s=%s\n", k, envQuote(s))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func envQuote(s string) string {
+	switch {
+	case envPlainRE.MatchString(s):
+		return s
+
+	case !strings.ContainsAny(s, "'\n\r"):
+		return "'" + s + "'"
+
+	default:
+		return `"` + envEscaper.Replace(s) + `"`
+	}
+}
+
+func envUnmarshalStream(in []byte, _ *Options) ([]any, error) {
+	ret := map[string]any{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE: %w", n, errors.ErrUnmarshal)
+		}
+
+		k = strings.TrimSpace(k)
+		if !envKeyRE.MatchString(k) {
+			return nil, fmt.Errorf("line %d: %q is not a valid env variable name: %w", n, k, errors.ErrUnmarshal)
+		}
+
+		v, err := envValue(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		ret[k] = v
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+	}
+
+	return []any{ret}, nil
+}
+
+func envValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+
+	switch q := v[0]; q {
+	case '\'', '"':
+		end := 1
+
+		for ; end < len(v); end++ {
+			if q == '"' && v[end] == '\\' {
+				end++
+				continue
+			}
+
+			if v[end] == q {
+				break
+			}
+		}
+
+		if end >= len(v) {
+			return "", fmt.Errorf("unterminated quote: %w", errors.ErrUnmarshal)
+		}
+
+		rest := strings.TrimSpace(v[end+1:])
+		if rest != "" && rest[0] != '#' {
+			return "", fmt.Errorf("unexpected %q after quoted value: %w", rest, errors.ErrUnmarshal)
+		}
+
+		if q == '\'' {
+			return v[1:end], nil
+		}
+
+		return envUnescaper.Replace(v[1:end]), nil
+
+	default:
+		if i := strings.Index(v, " #"); i != -1 {
+			v = strings.TrimSpace(v[:i])
+		}
+
+		return v, nil
+	}
+}
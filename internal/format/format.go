@@ -2,44 +2,145 @@ package format
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/gopatchy/bkl/pkg/errors"
 )
 
-// Format handles marshaling and unmarshaling for a specific file format
+// Format handles marshaling and unmarshaling for a specific file format.
+// NewDecoder and NewEncoder only return non-nil for formats that can be read
+// and written one document at a time.
 type Format struct {
-	MarshalStream   func([]any) ([]byte, error)
-	UnmarshalStream func([]byte) ([]any, error)
+	Options Options
+
+	unmarshalStream func([]byte, *Options) ([]any, error)
+	marshalStream   func([]any, *Options) ([]byte, error)
+	marshalValues   func([]any, *Options) ([]byte, error)
+	newDecoder      func(io.Reader, *Options) Decoder
+	newEncoder      func(io.Writer, *Options) Encoder
+}
+
+// UnmarshalStream reads a stream of documents.
+func (f *Format) UnmarshalStream(in []byte) ([]any, error) {
+	return f.unmarshalStream(in, &f.Options)
+}
+
+// MarshalStream writes vs as a stream of documents.
+func (f *Format) MarshalStream(vs []any) ([]byte, error) {
+	out, err := f.marshalStream(vs, &f.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Options.finish(out), nil
+}
+
+// MarshalValues is MarshalStream for values that aren't documents, like
+// query results: formats that write a null document as an empty one write a
+// null value as null.
+func (f *Format) MarshalValues(vs []any) ([]byte, error) {
+	if f.marshalValues == nil {
+		return f.MarshalStream(vs)
+	}
+
+	out, err := f.marshalValues(vs, &f.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Options.finish(out), nil
+}
+
+// NewDecoder returns a Decoder that reads from r, or nil if the format
+// can't be read one document at a time.
+func (f *Format) NewDecoder(r io.Reader) Decoder {
+	if f.newDecoder == nil {
+		return nil
+	}
+
+	return f.newDecoder(r, &f.Options)
+}
+
+// NewEncoder returns an Encoder that writes to w, or nil if the format
+// can't be written one document at a time.
+func (f *Format) NewEncoder(w io.Writer) Encoder {
+	if f.newEncoder == nil {
+		return nil
+	}
+
+	return f.newEncoder(w, &f.Options)
+}
+
+// Decoder reads one document per call and returns io.EOF after the last.
+type Decoder interface {
+	Decode() (any, error)
+}
+
+// Encoder writes one document per call.
+type Encoder interface {
+	Encode(any) error
 }
 
 var formatByExtension = map[string]Format{
+	"env": {
+		marshalStream:   envMarshalStream,
+		unmarshalStream: envUnmarshalStream,
+	},
+	"hcl": {
+		marshalStream:   hclMarshalStream,
+		unmarshalStream: hclUnmarshalStream,
+	},
+	"ini": {
+		marshalStream:   iniMarshalStream,
+		unmarshalStream: iniUnmarshalStream,
+	},
 	"json": {
-		MarshalStream:   jsonMarshalStream,
-		UnmarshalStream: jsonUnmarshalStream,
+		marshalStream:   jsonMarshalStream,
+		unmarshalStream: jsonUnmarshalStream,
+		newDecoder:      newJSONDecoder,
+		newEncoder:      newJSONEncoder,
 	},
 	"jsonl": {
-		MarshalStream:   jsonMarshalStream,
-		UnmarshalStream: jsonUnmarshalStream,
+		marshalStream:   jsonMarshalStream,
+		unmarshalStream: jsonUnmarshalStream,
+		newDecoder:      newJSONDecoder,
+		newEncoder:      newJSONEncoder,
 	},
 	"json-pretty": {
-		MarshalStream:   jsonMarshalStreamPretty,
-		UnmarshalStream: jsonUnmarshalStream,
+		marshalStream:   jsonMarshalStreamPretty,
+		unmarshalStream: jsonUnmarshalStream,
+		newDecoder:      newJSONDecoder,
+		newEncoder:      newJSONEncoderPretty,
 	},
 	"properties": {
-		MarshalStream:   propertiesMarshalStream,
-		UnmarshalStream: propertiesUnmarshalStream,
+		marshalStream:   propertiesMarshalStream,
+		unmarshalStream: propertiesUnmarshalStream,
+	},
+	"tf": {
+		marshalStream:   hclMarshalStream,
+		unmarshalStream: hclUnmarshalStream,
 	},
 	"toml": {
-		MarshalStream:   tomlMarshalStream,
-		UnmarshalStream: tomlUnmarshalStream,
+		marshalStream:   tomlMarshalStream,
+		unmarshalStream: tomlUnmarshalStream,
+	},
+	"xml": {
+		marshalStream:   xmlMarshalStream,
+		unmarshalStream: xmlUnmarshalStream,
 	},
 	"yaml": {
-		MarshalStream:   yamlMarshalStream,
-		UnmarshalStream: yamlUnmarshalStream,
+		marshalStream:   yamlMarshalStream,
+		marshalValues:   yamlMarshalValues,
+		unmarshalStream: yamlUnmarshalStream,
+		newDecoder:      newYAMLDecoder,
+		newEncoder:      newYAMLEncoder,
 	},
 	"yml": {
-		MarshalStream:   yamlMarshalStream,
-		UnmarshalStream: yamlUnmarshalStream,
+		marshalStream:   yamlMarshalStream,
+		marshalValues:   yamlMarshalValues,
+		unmarshalStream: yamlUnmarshalStream,
+		newDecoder:      newYAMLDecoder,
+		newEncoder:      newYAMLEncoder,
 	},
 }
 
@@ -0,0 +1,583 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// HCL has no schema-free way to tell blocks from object attributes, so:
+//   - Blocks of the types in hclBlockLabels are maps nested by label
+//   - Blocks of the types in hclSingleBlocks are maps, with repeated blocks
+//     merged, so a layer's block merges into its parent's
+//   - Other labeled blocks are maps under a `type "label"` key
+//   - Other unlabeled blocks are lists of maps (one entry per block)
+//   - Object attributes are maps
+//
+// Expressions that can't be evaluated without context (references, function
+// calls) are kept as "${...}" template strings.
+var hclBlockLabels = map[string]int{
+	"backend":     1,
+	"check":       1,
+	"data":        2,
+	"dynamic":     1,
+	"group":       1,
+	"job":         1,
+	"module":      1,
+	"output":      1,
+	"provider":    1,
+	"provisioner": 1,
+	"resource":    2,
+	"source":      2,
+	"task":        1,
+	"variable":    1,
+}
+
+var hclSingleBlocks = map[string]bool{
+	"cloud":              true,
+	"config":             true,
+	"connection":         true,
+	"ephemeral_disk":     true,
+	"lifecycle":          true,
+	"locals":             true,
+	"logs":               true,
+	"migrate":            true,
+	"required_providers": true,
+	"reschedule":         true,
+	"resources":          true,
+	"restart":            true,
+	"terraform":          true,
+	"timeouts":           true,
+	"update":             true,
+}
+
+// A `type "label" ...` key for a labeled block of a type not in
+// hclBlockLabels.
+var hclBlockKeyRE = regexp.MustCompile(`^([A-Za-z_][\w-]*)((?: "(?:[^"\\]|\\.)*")+)$`)
+
+var hclLabelRE = regexp.MustCompile(`"(?:[^"\\]|\\.)*"`)
+
+var hclTemplateRE = regexp.MustCompile(`^\$\{([^{}]*)\}$`)
+
+func hclMarshalStream(vs []any, _ *Options) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	for i, v := range vs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("hcl requires top-level map, got %T: %w", v, errors.ErrMarshal)
+		}
+
+		f := hclwrite.NewEmptyFile()
+
+		err := hclWriteBody(f.Body(), obj)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(hclwrite.Format(f.Bytes()))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func hclWriteBody(body *hclwrite.Body, obj map[string]any) error {
+	blocks := []string{}
+
+	for k, v := range utils.SortedMap(obj) {
+		if hclIsBlock(k, v) {
+			blocks = append(blocks, k)
+			continue
+		}
+
+		if !hclsyntax.ValidIdentifier(k) {
+			return fmt.Errorf("%q is not a valid attribute name: %w", k, errors.ErrMarshal)
+		}
+
+		tokens, err := hclTokens(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+
+		body.SetAttributeRaw(k, tokens)
+	}
+
+	for _, k := range blocks {
+		var err error
+
+		if typ, labels, ok := hclParseBlockKey(k); ok {
+			err = hclWriteBlocks(body, typ, labels, len(labels), obj[k])
+		} else {
+			err = hclWriteBlocks(body, k, nil, hclBlockLabels[k], obj[k])
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+func hclIsBlock(k string, v any) bool {
+	switch v2 := v.(type) {
+	case map[string]any:
+		_, _, ok := hclParseBlockKey(k)
+		return hclBlockLabels[k] > 0 || hclSingleBlocks[k] || ok
+
+	case []any:
+		return len(v2) > 0 && utils.IsListOfMaps(v2)
+
+	default:
+		return false
+	}
+}
+
+// hclBlockKey returns the key for a labeled block of a type not in
+// hclBlockLabels.
+func hclBlockKey(typ string, labels []string) string {
+	ret := typ
+
+	for _, label := range labels {
+		ret += " " + strconv.Quote(label)
+	}
+
+	return ret
+}
+
+// hclParseBlockKey splits a key from hclBlockKey into the block type and
+// labels.
+func hclParseBlockKey(k string) (string, []string, bool) {
+	m := hclBlockKeyRE.FindStringSubmatch(k)
+	if m == nil {
+		return "", nil, false
+	}
+
+	labels := []string{}
+
+	for _, quoted := range hclLabelRE.FindAllString(m[2], -1) {
+		label, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, false
+		}
+
+		labels = append(labels, label)
+	}
+
+	return m[1], labels, true
+}
+
+func hclWriteBlocks(body *hclwrite.Body, typ string, labels []string, depth int, v any) error {
+	if len(labels) < depth {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%v: expected map of labels, got %T: %w", labels, v, errors.ErrMarshal)
+		}
+
+		for k, v2 := range utils.SortedMap(m) {
+			err := hclWriteBlocks(body, typ, append(slices.Clone(labels), k), depth, v2)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	switch v2 := v.(type) {
+	case map[string]any:
+		if len(body.Attributes()) > 0 || len(body.Blocks()) > 0 {
+			body.AppendNewline()
+		}
+
+		return hclWriteBody(body.AppendNewBlock(typ, labels).Body(), v2)
+
+	case []any:
+		for _, v3 := range v2 {
+			err := hclWriteBlocks(body, typ, labels, depth, v3)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		return fmt.Errorf("%v: expected block body, got %T: %w", labels, v, errors.ErrMarshal)
+	}
+}
+
+func hclTokens(v any) (hclwrite.Tokens, error) {
+	switch v2 := v.(type) {
+	case nil:
+		return hclwrite.TokensForIdentifier("null"), nil
+
+	case bool:
+		return hclwrite.TokensForValue(cty.BoolVal(v2)), nil
+
+	case int:
+		return hclwrite.TokensForValue(cty.NumberIntVal(int64(v2))), nil
+
+	case int64:
+		return hclwrite.TokensForValue(cty.NumberIntVal(v2)), nil
+
+	case float64:
+		return hclwrite.TokensForValue(cty.NumberFloatVal(v2)), nil
+
+	case Number:
+		return hclwrite.Tokens{{Type: hclsyntax.TokenNumberLit, Bytes: []byte(v2)}}, nil
+
+	case Timestamp, Binary:
+		return hclwrite.TokensForValue(cty.StringVal(fmt.Sprint(v2))), nil
+
+	case *Tagged:
+		return hclTokens(map[string]any{v2.Tag: v2.Value})
+
+	case string:
+		if m := hclTemplateRE.FindStringSubmatch(v2); m != nil {
+			return hclwrite.Tokens{{Type: hclsyntax.TokenIdent, Bytes: []byte(m[1])}}, nil
+		}
+
+		if strings.Contains(v2, "${") || strings.Contains(v2, "%{") {
+			return hclwrite.Tokens{
+				{Type: hclsyntax.TokenOQuote, Bytes: []byte(`"`)},
+				{Type: hclsyntax.TokenQuotedLit, Bytes: []byte(hclEscaper.Replace(v2))},
+				{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
+			}, nil
+		}
+
+		return hclwrite.TokensForValue(cty.StringVal(v2)), nil
+
+	case []any:
+		elems := []hclwrite.Tokens{}
+
+		for _, v3 := range v2 {
+			tokens, err := hclTokens(v3)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, tokens)
+		}
+
+		return hclwrite.TokensForTuple(elems), nil
+
+	case map[string]any:
+		attrs := []hclwrite.ObjectAttrTokens{}
+
+		for k, v3 := range utils.SortedMap(v2) {
+			tokens, err := hclTokens(v3)
+			if err != nil {
+				return nil, err
+			}
+
+			name := hclwrite.TokensForValue(cty.StringVal(k))
+			if hclsyntax.ValidIdentifier(k) {
+				name = hclwrite.TokensForIdentifier(k)
+			}
+
+			attrs = append(attrs, hclwrite.ObjectAttrTokens{Name: name, Value: tokens})
+		}
+
+		return hclwrite.TokensForObject(attrs), nil
+
+	default:
+		return nil, fmt.Errorf("%T: %w", v, errors.ErrMarshal)
+	}
+}
+
+var hclEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+func hclUnmarshalStream(in []byte, _ *Options) ([]any, error) {
+	parts := tomlRE.Split(string(in), -1)
+	ret := []any{}
+
+	for i, s := range parts {
+		f, diags := hclsyntax.ParseConfig([]byte(s), fmt.Sprintf("doc%d.hcl", i), hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("%w: %w", diags, errors.ErrUnmarshal)
+		}
+
+		obj, err := hclReadBody(f.Body.(*hclsyntax.Body), f.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, obj)
+	}
+
+	return ret, nil
+}
+
+func hclReadBody(body *hclsyntax.Body, src []byte) (map[string]any, error) {
+	ret := map[string]any{}
+
+	for name, attr := range body.Attributes {
+		v, err := hclReadExpr(attr.Expr, src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		ret[name] = v
+	}
+
+	for _, block := range body.Blocks {
+		inner, err := hclReadBody(block.Body, src)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", block.Type, err)
+		}
+
+		err = hclAddBlock(ret, block, inner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func hclAddBlock(ret map[string]any, block *hclsyntax.Block, inner map[string]any) error {
+	switch {
+	case len(block.Labels) == 0 && hclSingleBlocks[block.Type]:
+		if ret[block.Type] == nil {
+			ret[block.Type] = inner
+			return nil
+		}
+
+		existing, ok := ret[block.Type].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: block conflicts with attribute: %w", block.Type, errors.ErrUnmarshal)
+		}
+
+		for k, v := range inner {
+			if _, found := existing[k]; found {
+				return fmt.Errorf("%s: %s: set in more than one block: %w", block.Type, k, errors.ErrUnmarshal)
+			}
+
+			existing[k] = v
+		}
+
+		return nil
+
+	case len(block.Labels) == 0:
+		list, ok := ret[block.Type].([]any)
+		if !ok && ret[block.Type] != nil {
+			return fmt.Errorf("%s: block conflicts with attribute: %w", block.Type, errors.ErrUnmarshal)
+		}
+
+		ret[block.Type] = append(list, inner)
+
+		return nil
+
+	case hclBlockLabels[block.Type] != len(block.Labels):
+		hclAddLabeled(ret, hclBlockKey(block.Type, block.Labels), inner)
+		return nil
+	}
+
+	cur := ret
+	keys := append([]string{block.Type}, block.Labels[:len(block.Labels)-1]...)
+
+	for _, k := range keys {
+		if cur[k] == nil {
+			cur[k] = map[string]any{}
+		}
+
+		next, ok := cur[k].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s %v: block conflicts with %T: %w", block.Type, block.Labels, cur[k], errors.ErrUnmarshal)
+		}
+
+		cur = next
+	}
+
+	hclAddLabeled(cur, block.Labels[len(block.Labels)-1], inner)
+
+	return nil
+}
+
+// hclAddLabeled sets m[k] to the body of a labeled block, or to a list of
+// bodies if there's more than one block with the same labels.
+func hclAddLabeled(m map[string]any, k string, inner map[string]any) {
+	switch existing := m[k].(type) {
+	case nil:
+		m[k] = inner
+
+	case []any:
+		m[k] = append(existing, inner)
+
+	default:
+		m[k] = []any{existing, inner}
+	}
+}
+
+func hclReadExpr(expr hclsyntax.Expression, src []byte) (any, error) {
+	switch e := expr.(type) {
+	case *hclsyntax.TupleConsExpr:
+		ret := []any{}
+
+		for _, e2 := range e.Exprs {
+			v, err := hclReadExpr(e2, src)
+			if err != nil {
+				return nil, err
+			}
+
+			ret = append(ret, v)
+		}
+
+		return ret, nil
+
+	case *hclsyntax.ObjectConsExpr:
+		ret := map[string]any{}
+
+		for _, item := range e.Items {
+			k := hcl.ExprAsKeyword(item.KeyExpr)
+			if k == "" {
+				kv, diags := item.KeyExpr.Value(nil)
+				if diags.HasErrors() || kv.Type() != cty.String || !kv.IsKnown() || kv.IsNull() {
+					return nil, fmt.Errorf("%s: unsupported object key: %w", hclSource(item.KeyExpr, src), errors.ErrUnmarshal)
+				}
+
+				k = kv.AsString()
+			}
+
+			v, err := hclReadExpr(item.ValueExpr, src)
+			if err != nil {
+				return nil, err
+			}
+
+			ret[k] = v
+		}
+
+		return ret, nil
+
+	case *hclsyntax.LiteralValueExpr:
+		if e.Val.Type() == cty.Number {
+			return ParseNumber(hclSource(e, src))
+		}
+
+	case *hclsyntax.UnaryOpExpr:
+		if lit, ok := e.Val.(*hclsyntax.LiteralValueExpr); ok && e.Op == hclsyntax.OpNegate && lit.Val.Type() == cty.Number {
+			return ParseNumber("-" + hclSource(lit, src))
+		}
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		switch e := expr.(type) {
+		case *hclsyntax.TemplateExpr:
+			if !e.IsStringLiteral() && strings.HasPrefix(hclSource(e, src), `"`) {
+				return hclTemplate(e.Parts, src), nil
+			}
+
+		case *hclsyntax.TemplateWrapExpr:
+			return "${" + hclSource(e.Wrapped, src) + "}", nil
+		}
+
+		return "${" + hclSource(expr, src) + "}", nil
+	}
+
+	return hclValue(val)
+}
+
+// hclTemplate returns the parts of a quoted template as a "...${...}..."
+// string, with the escapes of literal parts decoded so that hclEscaper can
+// write them back.
+func hclTemplate(parts []hclsyntax.Expression, src []byte) string {
+	ret := strings.Builder{}
+
+	for _, part := range parts {
+		if lit, ok := part.(*hclsyntax.LiteralValueExpr); ok && lit.Val.Type() == cty.String {
+			ret.WriteString(lit.Val.AsString())
+			continue
+		}
+
+		ret.WriteString("${" + hclSource(part, src) + "}")
+	}
+
+	return ret.String()
+}
+
+func hclSource(expr hcl.Expression, src []byte) string {
+	r := expr.Range()
+	return string(src[r.Start.Byte:r.End.Byte])
+}
+
+func hclValue(val cty.Value) (any, error) {
+	if val.IsNull() || !val.IsKnown() {
+		return nil, nil
+	}
+
+	t := val.Type()
+
+	switch {
+	case t == cty.String:
+		return val.AsString(), nil
+
+	case t == cty.Bool:
+		return val.True(), nil
+
+	case t == cty.Number:
+		bf := val.AsBigFloat()
+
+		if bf.IsInt() {
+			if i, acc := bf.Int64(); acc == big.Exact {
+				return int(i), nil
+			}
+		}
+
+		f, _ := bf.Float64()
+
+		return f, nil
+
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		ret := []any{}
+
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+
+			v2, err := hclValue(v)
+			if err != nil {
+				return nil, err
+			}
+
+			ret = append(ret, v2)
+		}
+
+		return ret, nil
+
+	case t.IsMapType() || t.IsObjectType():
+		ret := map[string]any{}
+
+		for it := val.ElementIterator(); it.Next(); {
+			k, v := it.Element()
+
+			v2, err := hclValue(v)
+			if err != nil {
+				return nil, err
+			}
+
+			ret[k.AsString()] = v2
+		}
+
+		return ret, nil
+
+	default:
+		return nil, fmt.Errorf("%s: %w", t.FriendlyName(), errors.ErrUnmarshal)
+	}
+}
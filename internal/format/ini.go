@@ -0,0 +1,173 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// INI sections become maps; [a.b] sections nest like properties keys. Keys
+// before the first section are top-level. Values are strings, with lists
+// joined by commas as in properties. Only whole-line ; and # comments are
+// recognized.
+
+func iniMarshalStream(vs []any, _ *Options) ([]byte, error) {
+	if len(vs) != 1 {
+		return nil, fmt.Errorf("ini format only supports single document: %w", errors.ErrMarshal)
+	}
+
+	obj, ok := vs[0].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("ini requires top-level map, got %T: %w", vs[0], errors.ErrMarshal)
+	}
+
+	buf := &bytes.Buffer{}
+
+	err := iniWriteSection(buf, "", obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimPrefix(buf.Bytes(), []byte("\n")), nil
+}
+
+func iniWriteSection(buf *bytes.Buffer, name string, obj map[string]any) error {
+	sections := []string{}
+	header := false
+
+	for k, v := range utils.SortedMap(obj) {
+		if strings.ContainsAny(k, "=:[]\n") || k == "" || strings.TrimSpace(k) != k {
+			return fmt.Errorf("%q is not a valid ini key: %w", k, errors.ErrMarshal)
+		}
+
+		if _, ok := v.(map[string]any); ok {
+			sections = append(sections, k)
+			continue
+		}
+
+		if !header && name != "" {
+			fmt.Fprintf(buf, "\n[%s]\n", name)
+			header = true
+		}
+
+		fmt.Fprintf(buf, "%s = %s\n", k, iniQuote(iniString(v)))
+	}
+
+	for _, k := range sections {
+		sub := k
+		if name != "" {
+			sub = name + "." + k
+		}
+
+		sobj := obj[k].(map[string]any)
+
+		if len(sobj) == 0 {
+			fmt.Fprintf(buf, "\n[%s]\n", sub)
+			continue
+		}
+
+		err := iniWriteSection(buf, sub, sobj)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func iniString(v any) string {
+	switch v2 := v.(type) {
+	case nil:
+		return ""
+
+	case []any:
+		vals := []string{}
+
+		for _, v3 := range v2 {
+			vals = append(vals, fmt.Sprint(v3))
+		}
+
+		return strings.Join(vals, ",")
+
+	default:
+		return fmt.Sprint(v2)
+	}
+}
+
+func iniQuote(s string) string {
+	if strings.TrimSpace(s) != s || strings.ContainsAny(s, "\"\n\r") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func iniUnmarshalStream(in []byte, _ *Options) ([]any, error) {
+	ret := map[string]any{}
+	cur := ret
+
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			name, ok := strings.CutSuffix(line[1:], "]")
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated section: %w", n, errors.ErrUnmarshal)
+			}
+
+			cur = ret
+
+			for _, part := range strings.Split(strings.TrimSpace(name), ".") {
+				if cur[part] == nil {
+					cur[part] = map[string]any{}
+				}
+
+				next, ok := cur[part].(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("line %d: section %s conflicts with %T: %w", n, name, cur[part], errors.ErrUnmarshal)
+				}
+
+				cur = next
+			}
+
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value: %w", n, errors.ErrUnmarshal)
+		}
+
+		k := strings.TrimSpace(line[:i])
+		v := strings.TrimSpace(line[i+1:])
+
+		if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+			v2, err := strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w: %w", n, err, errors.ErrUnmarshal)
+			}
+
+			v = v2
+		}
+
+		cur[k] = v
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+	}
+
+	return []any{ret}, nil
+}
@@ -7,10 +7,9 @@ import (
 	"io"
 )
 
-func jsonMarshalStream(vs []any) ([]byte, error) {
+func jsonMarshalStream(vs []any, opts *Options) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	enc := json.NewEncoder(buf)
-	enc.SetEscapeHTML(false)
+	enc := newJSONEncoder(buf, opts)
 
 	for _, v := range vs {
 		err := enc.Encode(v)
@@ -22,11 +21,9 @@ func jsonMarshalStream(vs []any) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func jsonMarshalStreamPretty(vs []any) ([]byte, error) {
+func jsonMarshalStreamPretty(vs []any, opts *Options) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	enc := json.NewEncoder(buf)
-	enc.SetIndent("", "  ")
-	enc.SetEscapeHTML(false)
+	enc := newJSONEncoderPretty(buf, opts)
 
 	for _, v := range vs {
 		err := enc.Encode(v)
@@ -38,15 +35,12 @@ func jsonMarshalStreamPretty(vs []any) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func jsonUnmarshalStream(in []byte) ([]any, error) {
-	dec := json.NewDecoder(bytes.NewReader(in))
-	dec.UseNumber()
+func jsonUnmarshalStream(in []byte, opts *Options) ([]any, error) {
+	dec := newJSONDecoder(bytes.NewReader(in), opts)
 	ret := []any{}
 
 	for {
-		var obj any
-
-		err := dec.Decode(&obj)
+		obj, err := dec.Decode()
 		if errors.Is(err, io.EOF) {
 			break
 		} else if err != nil {
@@ -58,3 +52,40 @@ func jsonUnmarshalStream(in []byte) ([]any, error) {
 
 	return ret, nil
 }
+
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func newJSONDecoder(r io.Reader, _ *Options) Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	return &jsonDecoder{dec: dec}
+}
+
+func (d *jsonDecoder) Decode() (any, error) {
+	var obj any
+
+	err := d.dec.Decode(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+func newJSONEncoder(w io.Writer, _ *Options) Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return enc
+}
+
+func newJSONEncoderPretty(w io.Writer, opts *Options) Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", opts.indentString())
+	enc.SetEscapeHTML(false)
+
+	return enc
+}
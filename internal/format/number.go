@@ -0,0 +1,132 @@
+package format
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Number is a number kept as its source text, for integers that don't fit in
+// an int64, decimals that a float64 wouldn't print the same way (0.10, 1.0)
+// and values a float64 can't hold (1.0000000000000000001e5, 1e400). Formats
+// that have a number type write the text as-is; others write it as a string.
+type Number string
+
+var jsonNumberRE = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// ParseNumber returns s as an int (or int64) if it fits, otherwise a float64
+// if that keeps its value (and, without an exponent, its text), otherwise a
+// Number.
+func ParseNumber(s string) (any, error) {
+	s = strings.TrimPrefix(s, "+")
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		if i == int64(int(i)) {
+			return int(i), nil
+		}
+
+		return i, nil
+	}
+
+	if !jsonNumberRE.MatchString(s) {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	if !strings.ContainsAny(s, ".eE") {
+		return Number(s), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !math.IsInf(f, 0) {
+		return nil, err
+	}
+
+	if !strings.ContainsAny(s, "eE") {
+		if s == strconv.FormatFloat(f, 'f', -1, 64) {
+			return f, nil
+		}
+
+		return Number(s), nil
+	}
+
+	exact, _ := (&big.Rat{}).SetString(s)
+	short, ok := (&big.Rat{}).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+
+	if ok && exact.Cmp(short) == 0 {
+		return f, nil
+	}
+
+	return Number(s), nil
+}
+
+// IsInt reports whether n has no fraction or exponent.
+func (n Number) IsInt() bool {
+	return !strings.ContainsAny(string(n), ".eE")
+}
+
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+func (n Number) String() string {
+	return string(n)
+}
+
+func (n Number) MarshalJSON() ([]byte, error) {
+	return []byte(n), nil
+}
+
+func (n Number) MarshalYAML() (any, error) {
+	tag := "!!float"
+	if n.IsInt() {
+		tag = "!!int"
+	}
+
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   tag,
+		Value: string(n),
+	}, nil
+}
+
+// yamlInt parses the YAML 1.2 integer forms: decimal, 0x hex, 0o octal and
+// 0b binary, with optional sign and _ separators. Unlike YAML 1.1, a leading
+// 0 doesn't mean octal.
+func yamlInt(s string) (any, error) {
+	s = strings.ReplaceAll(s, "_", "")
+
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) < 2 || digits[0] != '0' || !strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return ParseNumber(s)
+	}
+
+	i, ok := (&big.Int{}).SetString(s, 0)
+	if !ok {
+		return nil, &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrSyntax}
+	}
+
+	return ParseNumber(i.String())
+}
+
+// yamlFloat parses YAML floats, including .inf and .nan.
+func yamlFloat(s string) (any, error) {
+	s = strings.ReplaceAll(s, "_", "")
+
+	switch strings.ToLower(strings.TrimPrefix(s, "+")) {
+	case ".inf":
+		return math.Inf(1), nil
+
+	case "-.inf":
+		return math.Inf(-1), nil
+
+	case ".nan":
+		return math.NaN(), nil
+	}
+
+	return ParseNumber(s)
+}
@@ -0,0 +1,39 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Options control how documents are read and written. The zero value is
+// each format's default style. Field tags are the MCP argument names and the
+// command-line flags shared by the CLIs.
+type Options struct {
+	Indent           int    `json:"indent,omitempty" long:"indent" description:"spaces per indentation level for yaml, json-pretty, toml arrays and xml (default 2)"`
+	CompactSequences bool   `json:"compactSequences,omitempty" long:"compact-sequences" description:"count the \"- \" of yaml list items as indentation, lining them up with their key at the default indent"`
+	Quote            string `json:"quote,omitempty" long:"quote" description:"quote every yaml string value (default: only where needed)" choice:"single" choice:"double"`
+	LineWidth        int    `json:"lineWidth,omitempty" long:"line-width" description:"fold yaml string values longer than this onto several lines (default: never)"`
+	Literal          bool   `json:"literal,omitempty" long:"literal" description:"write multi-line yaml strings as literal blocks (|), even with --quote"`
+	NoFinalNewline   bool   `json:"noFinalNewline,omitempty" long:"no-final-newline" description:"omit the newline at the end of the output"`
+	PreserveTags     bool   `json:"preserveTags,omitempty" long:"preserve-tags" description:"keep custom yaml tags (e.g. !Ref, !Sub) on input values and write them back out"`
+}
+
+func (o *Options) indent() int {
+	if o.Indent <= 0 {
+		return 2
+	}
+
+	return o.Indent
+}
+
+func (o *Options) indentString() string {
+	return strings.Repeat(" ", o.indent())
+}
+
+func (o *Options) finish(out []byte) []byte {
+	if o.NoFinalNewline {
+		return bytes.TrimSuffix(out, []byte("\n"))
+	}
+
+	return out
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/magiconair/properties"
 )
 
-func propertiesMarshalStream(stream []any) ([]byte, error) {
+func propertiesMarshalStream(stream []any, _ *Options) ([]byte, error) {
 	if len(stream) != 1 {
 		return nil, fmt.Errorf("properties format only supports single document")
 	}
@@ -58,7 +58,7 @@ func flattenMap(prefix string, m map[string]any, p *properties.Properties) error
 		case bool:
 			p.Set(fullKey, fmt.Sprintf("%t", v))
 
-		case int, int64, float64:
+		case int, int64, float64, Number:
 			p.Set(fullKey, fmt.Sprintf("%v", v))
 
 		case map[string]any:
@@ -82,7 +82,7 @@ func flattenMap(prefix string, m map[string]any, p *properties.Properties) error
 	return nil
 }
 
-func propertiesUnmarshalStream(data []byte) ([]any, error) {
+func propertiesUnmarshalStream(data []byte, _ *Options) ([]any, error) {
 	p, err := properties.Load(data, properties.UTF8)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,114 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.yaml.in/yaml/v3"
+)
+
+// Timestamp is a date, date-time or time kept as its source text, so that
+// local times and fractional seconds survive. YAML and TOML write it as their
+// own timestamp type; other formats write the text.
+type Timestamp string
+
+func (t Timestamp) String() string {
+	return string(t)
+}
+
+func (t Timestamp) MarshalYAML() (any, error) {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!timestamp",
+		Value: string(t),
+	}, nil
+}
+
+// toml returns t as the go-toml type for its form, or a string if it isn't
+// one TOML has.
+func (t Timestamp) toml() any {
+	var d toml.LocalDate
+	if d.UnmarshalText([]byte(t)) == nil {
+		return d
+	}
+
+	var dt toml.LocalDateTime
+	if dt.UnmarshalText([]byte(t)) == nil {
+		return dt
+	}
+
+	var lt toml.LocalTime
+	if lt.UnmarshalText([]byte(t)) == nil {
+		return lt
+	}
+
+	var zt time.Time
+	if yaml.Unmarshal([]byte(t), &zt) == nil {
+		return zt
+	}
+
+	return string(t)
+}
+
+// Binary is raw bytes from a YAML !!binary value or $decode: base64. YAML
+// writes it back as !!binary; other formats write it base64-encoded.
+type Binary string
+
+func (b Binary) String() string {
+	return base64.StdEncoding.EncodeToString([]byte(b))
+}
+
+func (b Binary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func (b Binary) MarshalYAML() (any, error) {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!binary",
+		Value: b.String(),
+	}, nil
+}
+
+// Tagged is a value with a custom YAML tag, read when Options.PreserveTags
+// is set.
+// YAML writes the tag back; other formats write {tag: value}. Tagged values
+// aren't merged into, only replaced.
+type Tagged struct {
+	Tag   string
+	Value any
+}
+
+func (t *Tagged) String() string {
+	return fmt.Sprintf("%s %v", t.Tag, t.Value)
+}
+
+func (t *Tagged) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{t.Tag: t.Value})
+}
+
+func (t *Tagged) MarshalYAML() (any, error) {
+	node := &yaml.Node{}
+
+	err := node.Encode(t.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	node.Tag = t.Tag
+
+	return node, nil
+}
+
+func yamlBinary(s string) (Binary, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return "", err
+	}
+
+	return Binary(b), nil
+}
@@ -2,15 +2,23 @@ package format
 
 import (
 	"bytes"
+	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
 )
 
-func tomlMarshalStream(vs []any) ([]byte, error) {
+func tomlMarshalStream(vs []any, opts *Options) ([]byte, error) {
 	first := true
 	buf := &bytes.Buffer{}
-	enc := toml.NewEncoder(buf)
+	enc := toml.NewEncoder(buf).SetIndentSymbol(opts.indentString())
+	nums := []Number{}
 
 	for _, v := range vs {
 		first2 := first
@@ -22,18 +30,118 @@ func tomlMarshalStream(vs []any) ([]byte, error) {
 			}
 		}
 
-		err := enc.Encode(v)
+		v, err := tomlValue(v, &nums)
+		if err != nil {
+			return nil, err
+		}
+
+		err = enc.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := buf.Bytes()
+
+	for i, num := range nums {
+		out = bytes.Replace(out, []byte(fmt.Sprintf(`"\u0000bkl-number-%d\u0000"`, i)), []byte(num), 1)
+	}
+
+	return out, nil
+}
+
+// tomlNumberPlaceholder stands in for the i'th Number while encoding. The
+// encoder would round Numbers through int64 or float64, so they're written as
+// these strings (which it escapes as \u0000...\u0000) and replaced with their
+// text afterwards.
+func tomlNumberPlaceholder(i int) string {
+	return fmt.Sprintf("\x00bkl-number-%d\x00", i)
+}
+
+// tomlValue converts values to what the encoder writes as TOML types.
+// Numbers are appended to nums and replaced with placeholders. TOML integers
+// are int64, so larger integers are an error rather than silently changed.
+func tomlValue(v any, nums *[]Number) (any, error) {
+	switch v2 := v.(type) {
+	case Number:
+		if v2.IsInt() {
+			return nil, fmt.Errorf("%s exceeds toml integer range: %w", v2, errors.ErrMarshal)
+		}
+
+		*nums = append(*nums, v2)
+
+		return tomlNumberPlaceholder(len(*nums) - 1), nil
+
+	case Timestamp:
+		return v2.toml(), nil
+
+	case Binary:
+		return v2.String(), nil
+
+	case *Tagged:
+		value, err := tomlValue(v2.Value, nums)
 		if err != nil {
 			return nil, err
 		}
+
+		return map[string]any{v2.Tag: value}, nil
+
+	case map[string]any:
+		return utils.FilterMap(v2, func(k string, v3 any) (map[string]any, error) {
+			v4, err := tomlValue(v3, nums)
+			if err != nil {
+				return nil, err
+			}
+
+			return map[string]any{k: v4}, nil
+		})
+
+	case []any:
+		return utils.FilterList(v2, func(v3 any) ([]any, error) {
+			v4, err := tomlValue(v3, nums)
+			if err != nil {
+				return nil, err
+			}
+
+			return []any{v4}, nil
+		})
+
+	default:
+		return v, nil
 	}
+}
+
+// tomlTimestamps converts go-toml's date and time types to Timestamp.
+func tomlTimestamps(v any) any {
+	switch v2 := v.(type) {
+	case time.Time:
+		return Timestamp(v2.Format(time.RFC3339Nano))
+
+	case toml.LocalDate, toml.LocalDateTime, toml.LocalTime:
+		return Timestamp(fmt.Sprint(v2))
+
+	case map[string]any:
+		for k, v3 := range v2 {
+			v2[k] = tomlTimestamps(v3)
+		}
+
+		return v2
 
-	return buf.Bytes(), nil
+	case []any:
+		for i, v3 := range v2 {
+			v2[i] = tomlTimestamps(v3)
+		}
+
+		return v2
+
+	default:
+		return v
+	}
 }
 
 var tomlRE = regexp.MustCompile(`(?m)^(\+\+\+|---)$`)
 
-func tomlUnmarshalStream(in []byte) ([]any, error) {
+func tomlUnmarshalStream(in []byte, _ *Options) ([]any, error) {
 	parts := tomlRE.Split(string(in), -1)
 	ret := []any{}
 
@@ -45,8 +153,125 @@ func tomlUnmarshalStream(in []byte) ([]any, error) {
 			return nil, err
 		}
 
-		ret = append(ret, obj)
+		if m, ok := obj.(map[string]any); ok {
+			err = tomlNumbers(m, []byte(s))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret = append(ret, tomlTimestamps(obj))
 	}
 
 	return ret, nil
 }
+
+// tomlNumbers replaces the floats in obj, decoded from doc, with values
+// parsed from their source text, so 0.10 and 1.0 keep their form. It walks
+// the parsed document alongside the decoded tables.
+func tomlNumbers(obj map[string]any, doc []byte) error {
+	p := unstable.Parser{}
+	p.Reset(doc)
+
+	cur := obj
+	arrays := map[string]int{}
+
+	for p.NextExpression() {
+		expr := p.Expression()
+
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			cur = obj
+
+			for it := expr.Key(); it.Next(); {
+				k := string(it.Node().Data)
+				id := fmt.Sprintf("%p/%s", cur, k)
+
+				if expr.Kind == unstable.ArrayTable && it.IsLast() {
+					arrays[id]++
+				}
+
+				switch v := cur[k].(type) {
+				case map[string]any:
+					cur = v
+
+				case []any:
+					i := arrays[id] - 1
+					if i < 0 || i >= len(v) {
+						return nil
+					}
+
+					cur, _ = v[i].(map[string]any)
+
+				default:
+					return nil
+				}
+
+				if cur == nil {
+					return nil
+				}
+			}
+
+		case unstable.KeyValue:
+			tomlKeyValueNumbers(cur, expr)
+		}
+	}
+
+	return p.Error()
+}
+
+func tomlKeyValueNumbers(m map[string]any, n *unstable.Node) {
+	keys := []string{}
+
+	for it := n.Key(); it.Next(); {
+		keys = append(keys, string(it.Node().Data))
+	}
+
+	for _, k := range keys[:len(keys)-1] {
+		m, _ = m[k].(map[string]any)
+		if m == nil {
+			return
+		}
+	}
+
+	last := keys[len(keys)-1]
+	m[last] = tomlValueNumbers(m[last], n.Value())
+}
+
+// tomlValueNumbers returns v with floats parsed from n. Forms ParseNumber
+// doesn't know, like nan, keep the decoded value.
+func tomlValueNumbers(v any, n *unstable.Node) any {
+	switch n.Kind {
+	case unstable.Float:
+		num, err := ParseNumber(strings.ReplaceAll(string(n.Data), "_", ""))
+		if err != nil {
+			return v
+		}
+
+		return num
+
+	case unstable.Array:
+		list, ok := v.([]any)
+		if !ok {
+			return v
+		}
+
+		i := 0
+
+		for it := n.Children(); it.Next() && i < len(list); i++ {
+			list[i] = tomlValueNumbers(list[i], it.Node())
+		}
+
+	case unstable.InlineTable:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v
+		}
+
+		for it := n.Children(); it.Next(); {
+			tomlKeyValueNumbers(m, it.Node())
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,289 @@
+package format
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// XML documents map to a single-key map named after the root element:
+//   - Attributes are "@name" keys
+//   - Child elements are keys; repeated elements become lists
+//   - Elements with only text are strings
+//   - Text alongside attributes or children is a "#text" key
+//
+// Namespace prefixes are kept as written ("xsi:schemaLocation"), except that
+// bkl: elements and attributes become $ keys (<bkl:match id="db"/> is
+// $match: {"@id": db}). An element containing $match or $matches is always a
+// list entry, so a single element can patch a repeated one. Comments,
+// processing instructions and the relative order of differently-named
+// siblings are not preserved.
+
+var xmlNameRE = regexp.MustCompile(`^[A-Za-z_][\w.:-]*$`)
+
+func xmlMarshalStream(vs []any, opts *Options) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	for i, v := range vs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+
+		obj, ok := v.(map[string]any)
+		if !ok || len(obj) != 1 {
+			return nil, fmt.Errorf("xml requires a map with a single root element, got %T: %w", v, errors.ErrMarshal)
+		}
+
+		buf.WriteString(xml.Header)
+
+		for name, root := range obj {
+			err := xmlWriteElement(buf, opts, name, root, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func xmlWriteElement(buf *bytes.Buffer, opts *Options, name string, v any, depth int) error {
+	if !xmlNameRE.MatchString(name) {
+		return fmt.Errorf("%q is not a valid element name: %w", name, errors.ErrMarshal)
+	}
+
+	indent := strings.Repeat(opts.indentString(), depth)
+
+	switch v2 := v.(type) {
+	case []any:
+		for _, v3 := range v2 {
+			if _, ok := v3.([]any); ok {
+				return fmt.Errorf("%s: nested list: %w", name, errors.ErrMarshal)
+			}
+
+			err := xmlWriteElement(buf, opts, name, v3, depth)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case nil:
+		fmt.Fprintf(buf, "%s<%s/>\n", indent, name)
+		return nil
+
+	case map[string]any:
+		fmt.Fprintf(buf, "%s<%s", indent, name)
+
+		children := []string{}
+		text := ""
+
+		for k, v3 := range utils.SortedMap(v2) {
+			switch {
+			case k == "#text":
+				text = xmlEscape(fmt.Sprint(v3))
+
+			case strings.HasPrefix(k, "@"):
+				if !xmlNameRE.MatchString(k[1:]) {
+					return fmt.Errorf("%q is not a valid attribute name: %w", k, errors.ErrMarshal)
+				}
+
+				switch v3.(type) {
+				case map[string]any, []any:
+					return fmt.Errorf("%s %s: attribute value must be a scalar: %w", name, k, errors.ErrMarshal)
+				}
+
+				fmt.Fprintf(buf, ` %s="%s"`, k[1:], xmlEscape(fmt.Sprint(v3)))
+
+			default:
+				children = append(children, k)
+			}
+		}
+
+		switch {
+		case len(children) == 0 && text == "":
+			buf.WriteString("/>\n")
+
+		case len(children) == 0:
+			fmt.Fprintf(buf, ">%s</%s>\n", text, name)
+
+		default:
+			fmt.Fprintf(buf, ">%s\n", text)
+
+			for _, k := range children {
+				err := xmlWriteElement(buf, opts, k, v2[k], depth+1)
+				if err != nil {
+					return err
+				}
+			}
+
+			fmt.Fprintf(buf, "%s</%s>\n", indent, name)
+		}
+
+		return nil
+
+	default:
+		fmt.Fprintf(buf, "%s<%s>%s</%s>\n", indent, name, xmlEscape(fmt.Sprint(v2)), name)
+		return nil
+	}
+}
+
+func xmlEscape(s string) string {
+	buf := &bytes.Buffer{}
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+func xmlUnmarshalStream(in []byte, _ *Options) ([]any, error) {
+	parts := tomlRE.Split(string(in), -1)
+	ret := []any{}
+
+	for _, s := range parts {
+		obj, err := xmlUnmarshal([]byte(s))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		ret = append(ret, obj)
+	}
+
+	return ret, nil
+}
+
+func xmlUnmarshal(in []byte) (any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(in))
+
+	var ret map[string]any
+
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if ret != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+
+			v, err := xmlReadElement(dec, t.Copy())
+			if err != nil {
+				return nil, err
+			}
+
+			ret = map[string]any{xmlName(t.Name): v}
+
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("text outside root element")
+			}
+		}
+	}
+
+	if ret == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+
+	return ret, nil
+}
+
+func xmlReadElement(dec *xml.Decoder, start xml.StartElement) (any, error) {
+	ret := map[string]any{}
+	text := strings.Builder{}
+
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns" && attr.Name.Local == "bkl":
+
+		case attr.Name.Space == "bkl":
+			ret[xmlName(attr.Name)] = attr.Value
+
+		default:
+			ret["@"+xmlName(attr.Name)] = attr.Value
+		}
+	}
+
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := xmlReadElement(dec, t.Copy())
+			if err != nil {
+				return nil, err
+			}
+
+			name := xmlName(t.Name)
+
+			switch existing := ret[name].(type) {
+			case nil:
+				ret[name] = child
+
+				if xmlIsListEntry(child) {
+					ret[name] = []any{child}
+				}
+
+			case []any:
+				ret[name] = append(existing, child)
+
+			default:
+				ret[name] = []any{existing, child}
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+
+			if len(ret) == 0 {
+				return s, nil
+			}
+
+			if s != "" {
+				ret["#text"] = s
+			}
+
+			return ret, nil
+		}
+	}
+}
+
+func xmlIsListEntry(v any) bool {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	_, match := m["$match"]
+	_, matches := m["$matches"]
+
+	return match || matches
+}
+
+func xmlName(name xml.Name) string {
+	switch name.Space {
+	case "":
+		return name.Local
+
+	case "bkl":
+		return "$" + name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
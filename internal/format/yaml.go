@@ -6,33 +6,20 @@ import (
 	"io"
 	"maps"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
-	"gopkg.in/yaml.v3"
+	"go.yaml.in/yaml/v3"
 
 	"github.com/gopatchy/bkl/pkg/errors"
 )
 
-func yamlMarshalStream(vs []any) ([]byte, error) {
-	// Differs from repeated yaml.Encode by writing "---\n---" for an empty
-	// document rather than "null".
-
-	first := true
+func yamlMarshalStream(vs []any, opts *Options) ([]byte, error) {
 	buf := &bytes.Buffer{}
-	enc := yaml.NewEncoder(buf)
-	enc.SetIndent(2)
+	enc := newYAMLEncoder(buf, opts)
 
 	for _, v := range vs {
-		first2 := first
-		first = false
-
-		if v == nil {
-			if !first2 {
-				buf.Write([]byte("---\n"))
-			}
-
-			continue
-		}
-
 		err := enc.Encode(v)
 		if err != nil {
 			return nil, err
@@ -42,14 +29,33 @@ func yamlMarshalStream(vs []any) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func yamlUnmarshalStream(in []byte) ([]any, error) {
-	decoder := yaml.NewDecoder(bytes.NewReader(in))
+func yamlMarshalValues(vs []any, opts *Options) ([]byte, error) {
+	vals := make([]any, len(vs))
+
+	for i, v := range vs {
+		if v == nil {
+			v = yamlNull{}
+		}
+
+		vals[i] = v
+	}
+
+	return yamlMarshalStream(vals, opts)
+}
+
+// yamlNull is written as null, where nil would be an empty document.
+type yamlNull struct{}
+
+func (yamlNull) MarshalYAML() (any, error) {
+	return nil, nil
+}
+
+func yamlUnmarshalStream(in []byte, opts *Options) ([]any, error) {
+	dec := newYAMLDecoder(bytes.NewReader(in), opts)
 	ret := []any{}
 
 	for {
-		var node yaml.Node
-
-		err := decoder.Decode(&node)
+		obj, err := dec.Decode()
 		if err != nil {
 			if err == io.EOF {
 				break
@@ -57,27 +63,337 @@ func yamlUnmarshalStream(in []byte) ([]any, error) {
 			return nil, err
 		}
 
-		obj, err := yamlTranslateNode(&node)
-		if err != nil {
-			return nil, err
-		}
-
 		ret = append(ret, obj)
 	}
 
 	return ret, nil
 }
 
-func yamlTranslateNode(node *yaml.Node) (any, error) {
+type yamlDecoder struct {
+	dec  *yaml.Decoder
+	opts *Options
+}
+
+func newYAMLDecoder(r io.Reader, opts *Options) Decoder {
+	return &yamlDecoder{
+		dec:  yaml.NewDecoder(r),
+		opts: opts,
+	}
+}
+
+func (d *yamlDecoder) Decode() (any, error) {
+	var node yaml.Node
+
+	err := d.dec.Decode(&node)
+	if err != nil {
+		return nil, err
+	}
+
+	return yamlTranslateNode(&node, d.opts)
+}
+
+// yamlEncoder differs from repeated yaml.Encode by writing "---\n---" for an
+// empty document rather than "null".
+type yamlEncoder struct {
+	w     io.Writer
+	opts  *Options
+	enc   *yaml.Encoder
+	first bool
+	wrote bool
+}
+
+func newYAMLEncoder(w io.Writer, opts *Options) Encoder {
+	return &yamlEncoder{
+		w:     w,
+		opts:  opts,
+		enc:   newYAMLEncoderOptions(w, opts),
+		first: true,
+	}
+}
+
+func newYAMLEncoderOptions(w io.Writer, opts *Options) *yaml.Encoder {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(opts.indent())
+
+	if opts.CompactSequences {
+		enc.CompactSeqIndent()
+	}
+
+	return enc
+}
+
+func (e *yamlEncoder) Encode(v any) error {
+	first := e.first
+	e.first = false
+
+	if v == nil {
+		if first {
+			return nil
+		}
+
+		e.wrote = true
+		_, err := e.w.Write([]byte("---\n"))
+		return err
+	}
+
+	node := &yaml.Node{}
+
+	err := node.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	blocks := []yamlBlock{}
+	yamlStyle(node, e.opts, &blocks)
+
+	if !e.opts.Literal && e.opts.LineWidth <= 0 {
+		return e.enc.Encode(node)
+	}
+
+	// The encoder can't wrap lines and won't always write a literal block, so
+	// those strings are written as placeholders and replaced afterwards. Each
+	// document gets its own encoder so the output can be rewritten before it's
+	// written.
+	buf := &bytes.Buffer{}
+
+	if e.wrote {
+		buf.WriteString("---\n")
+	}
+
+	enc := newYAMLEncoderOptions(buf, e.opts)
+
+	err = enc.Encode(node)
+	if err != nil {
+		return err
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return err
+	}
+
+	e.wrote = true
+	_, err = e.w.Write(yamlWriteBlocks(buf.Bytes(), blocks, e.opts))
+
+	return err
+}
+
+type yamlBlock struct {
+	literal bool
+	value   string
+}
+
+// yamlStyle applies the string quoting options to the values (not keys) in
+// node, and quotes strings that would read back as numbers. Strings to write as blocks are replaced by placeholders and appended
+// to blocks.
+func yamlStyle(node *yaml.Node, opts *Options, blocks *[]yamlBlock) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, n := range node.Content {
+			yamlStyle(n, opts, blocks)
+		}
+
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			yamlStyle(node.Content[i], opts, blocks)
+		}
+
+	case yaml.ScalarNode:
+		if (node.Tag == "!!int" || node.Tag == "!!float") && node.Style&yaml.TaggedStyle != 0 {
+			// Numbers that don't fit in an int64 or float64 (1e400) are
+			// written plain rather than tagged; they read back as numbers
+			node.Tag = ""
+			node.Style &^= yaml.TaggedStyle
+			return
+		}
+
+		if node.Tag != "!!str" {
+			return
+		}
+
+		switch {
+		case opts.Literal && yamlLiteralable(node.Value):
+			*blocks = append(*blocks, yamlBlock{literal: true, value: node.Value})
+			node.Value = yamlBlockPlaceholder(len(*blocks) - 1)
+			node.Style = 0
+
+		case opts.LineWidth > 0 && yamlFoldable(node.Value, opts.LineWidth):
+			*blocks = append(*blocks, yamlBlock{value: node.Value})
+			node.Value = yamlBlockPlaceholder(len(*blocks) - 1)
+			node.Style = 0
+
+		case opts.Quote == "single":
+			node.Style = yaml.SingleQuotedStyle
+
+		case opts.Quote == "double":
+			node.Style = yaml.DoubleQuotedStyle
+
+		case node.Style == 0 && jsonNumberRE.MatchString(strings.TrimPrefix(node.Value, "+")):
+			// The encoder leaves strings like 1e400 plain because they don't
+			// fit in a float64, but they read back as numbers
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+}
+
+// yamlLiteralable reports whether s is multi-line and would read back
+// unchanged from a literal block without an indentation indicator: printable,
+// and not starting with a space or line break.
+func yamlLiteralable(s string) bool {
+	if !strings.Contains(s, "\n") || s[0] == ' ' || s[0] == '\n' || !utf8.ValidString(s) {
+		return false
+	}
+
+	for _, r := range s {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// yamlFoldable reports whether s is too long and would read back unchanged
+// from a folded block: single spaces between words, nothing at either end.
+func yamlFoldable(s string, width int) bool {
+	return len(s) > width &&
+		strings.Contains(s, " ") &&
+		!strings.ContainsAny(s, "\t\r\n") &&
+		!strings.Contains(s, "  ") &&
+		strings.TrimSpace(s) == s
+}
+
+func yamlBlockPlaceholder(i int) string {
+	return fmt.Sprintf("bkl-block-%d", i)
+}
+
+// yamlWriteBlocks replaces the placeholders in out, each at the end of a line
+// after "key: " or "- ", with the matching string as a literal or folded
+// block.
+func yamlWriteBlocks(out []byte, blocks []yamlBlock, opts *Options) []byte {
+	lines := strings.SplitAfter(string(out), "\n")
+	ret := &bytes.Buffer{}
+	next := 0
+
+	for _, line := range lines {
+		if next >= len(blocks) {
+			ret.WriteString(line)
+			continue
+		}
+
+		prefix, found := strings.CutSuffix(line, yamlBlockPlaceholder(next)+"\n")
+		if !found || (prefix != "" && !strings.HasSuffix(prefix, " ")) {
+			ret.WriteString(line)
+			continue
+		}
+
+		rest := strings.TrimLeft(prefix, " ")
+		indent := len(prefix) - len(rest)
+
+		for strings.HasPrefix(rest, "- ") {
+			rest = rest[2:]
+			indent += 2
+		}
+
+		if rest == "" && prefix != "" {
+			// Directly in a sequence, indented from the "- "
+			indent -= 2
+		}
+
+		indent += opts.indent()
+
+		ret.WriteString(prefix)
+
+		if blocks[next].literal {
+			yamlWriteLiteral(ret, blocks[next].value, indent)
+		} else {
+			yamlWriteFolded(ret, blocks[next].value, indent, opts.LineWidth)
+		}
+
+		next++
+	}
+
+	return ret.Bytes()
+}
+
+func yamlWriteLiteral(buf *bytes.Buffer, s string, indent int) {
+	body := strings.TrimRight(s, "\n")
+
+	switch len(s) - len(body) {
+	case 0:
+		buf.WriteString("|-\n")
+
+	case 1:
+		buf.WriteString("|\n")
+
+	default:
+		buf.WriteString("|+\n")
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" {
+			buf.WriteString(strings.Repeat(" ", indent))
+			buf.WriteString(line)
+		}
+
+		buf.WriteString("\n")
+	}
+
+	if len(s)-len(body) > 1 {
+		buf.WriteString(strings.Repeat("\n", len(s)-len(body)-1))
+	}
+}
+
+func yamlWriteFolded(buf *bytes.Buffer, s string, indent int, lineWidth int) {
+	buf.WriteString(">-\n")
+
+	width := max(lineWidth-indent, 1)
+	lineLen := 0
+
+	for i, word := range strings.Split(s, " ") {
+		switch {
+		case i == 0:
+			buf.WriteString(strings.Repeat(" ", indent))
+
+		case lineLen+1+len(word) > width:
+			buf.WriteString("\n")
+			buf.WriteString(strings.Repeat(" ", indent))
+			lineLen = 0
+
+		default:
+			buf.WriteString(" ")
+			lineLen++
+		}
+
+		buf.WriteString(word)
+		lineLen += len(word)
+	}
+
+	buf.WriteString("\n")
+}
+
+func yamlTranslateNode(node *yaml.Node, opts *Options) (any, error) {
+	if opts.PreserveTags && strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!") {
+		untagged := *node
+		untagged.Tag = ""
+
+		v, err := yamlTranslateNode(&untagged, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Tagged{Tag: node.Tag, Value: v}, nil
+	}
+
 	switch node.Kind {
 	case yaml.DocumentNode:
-		return yamlTranslateNode(node.Content[0])
+		return yamlTranslateNode(node.Content[0], opts)
 
 	case yaml.SequenceNode:
 		ret := []any{}
 
 		for _, v := range node.Content {
-			v2, err := yamlTranslateNode(v)
+			v2, err := yamlTranslateNode(v, opts)
 			if err != nil {
 				return nil, err
 			}
@@ -93,7 +409,7 @@ func yamlTranslateNode(node *yaml.Node) (any, error) {
 		// First see if there's a merge statement, and merge the referenced map(s) into ret.
 		for i := 0; i+1 < len(node.Content); i += 2 {
 			if node.Content[i].Value == "<<" {
-				v2, err := yamlTranslateNode(node.Content[i+1])
+				v2, err := yamlTranslateNode(node.Content[i+1], opts)
 				if err != nil {
 					return nil, err
 				}
@@ -111,7 +427,7 @@ func yamlTranslateNode(node *yaml.Node) (any, error) {
 				continue
 			}
 
-			v2, err := yamlTranslateNode(node.Content[i+1])
+			v2, err := yamlTranslateNode(node.Content[i+1], opts)
 			if err != nil {
 				return nil, err
 			}
@@ -127,29 +443,35 @@ func yamlTranslateNode(node *yaml.Node) (any, error) {
 			return strconv.ParseBool(node.Value)
 
 		case "!!int":
-			// TODO: Get away from 32-bit ints entirely
-			v, err := strconv.ParseInt(node.Value, 10, 32)
-			if err == nil {
-				return int(v), nil
-			}
-
-			return strconv.ParseInt(node.Value, 10, 64)
+			return yamlInt(node.Value)
 
 		case "!!float":
-			return strconv.ParseFloat(node.Value, 64)
+			return yamlFloat(node.Value)
 
 		case "!!null":
 			return nil, nil
 
-		case "!!str", "!!timestamp":
+		case "!!str":
+			// The decoder reads a plain float it can't fit in a float64
+			// (1e400) as a string; keep it as a number, as JSON does
+			if node.Style == 0 && jsonNumberRE.MatchString(strings.TrimPrefix(node.Value, "+")) {
+				return ParseNumber(node.Value)
+			}
+
 			return node.Value, nil
 
+		case "!!timestamp":
+			return Timestamp(node.Value), nil
+
+		case "!!binary":
+			return yamlBinary(node.Value)
+
 		default:
 			return nil, fmt.Errorf("unknown yaml short tag: %s (%w)", node.ShortTag(), errors.ErrInvalidType)
 		}
 
 	case yaml.AliasNode:
-		return yamlTranslateNode(node.Alias)
+		return yamlTranslateNode(node.Alias, opts)
 
 	case 0:
 		return nil, nil
@@ -0,0 +1,109 @@
+package fsys
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Overlay is Base with files replaced or added, e.g. unsaved editor text or
+// files that haven't been written yet. Files is keyed by absolute path; names
+// passed to the fs.FS methods are the same paths without the leading slash,
+// as with os.DirFS("/").
+type Overlay struct {
+	Base  fs.FS
+	Files map[string][]byte
+}
+
+func NewOverlay(base fs.FS, files map[string][]byte) *Overlay {
+	return &Overlay{
+		Base:  base,
+		Files: files,
+	}
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	if data, found := o.file(name); found {
+		return &memFile{
+			Reader: bytes.NewReader(data),
+			info:   memFileInfo{name: path.Base(name), size: int64(len(data))},
+		}, nil
+	}
+
+	return o.Base.Open(name)
+}
+
+func (o *Overlay) Stat(name string) (fs.FileInfo, error) {
+	if data, found := o.file(name); found {
+		return memFileInfo{name: path.Base(name), size: int64(len(data))}, nil
+	}
+
+	return fs.Stat(o.Base, name)
+}
+
+// ReadDir includes files that are only in the overlay, even in directories
+// that don't exist in Base.
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.Base, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	dir := path.Join("/", name)
+
+	for p, data := range o.Files {
+		if path.Dir(p) != dir {
+			continue
+		}
+
+		base := path.Base(p)
+
+		if slices.ContainsFunc(entries, func(e fs.DirEntry) bool { return e.Name() == base }) {
+			continue
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: base, size: int64(len(data))}))
+	}
+
+	if len(entries) == 0 && err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+
+	return entries, nil
+}
+
+func (o *Overlay) file(name string) ([]byte, bool) {
+	data, found := o.Files["/"+strings.TrimPrefix(name, "/")]
+	return data, found
+}
+
+type memFile struct {
+	*bytes.Reader
+	info memFileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return 0o644 }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() any           { return nil }
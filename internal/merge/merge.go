@@ -81,7 +81,11 @@ func patchMatch(docs []*document.Document, patch *document.Document) (bool, []*d
 		return true, newDocs, err
 	}
 
-	matches := findMatches(docs, patch, m)
+	matches, err := findMatches(docs, patch, m)
+	if err != nil {
+		return true, nil, err
+	}
+
 	if len(matches) == 0 {
 		return true, nil, fmt.Errorf("%#v: %w", m, errors.ErrNoMatchFound)
 	}
@@ -110,7 +114,11 @@ func patchMatches(docs []*document.Document, patch *document.Document) (bool, []
 	matchedDocs := make(map[string]*document.Document)
 
 	for i, matchPattern := range matchesList {
-		matched := findMatches(docs, patch, matchPattern)
+		matched, err := findMatches(docs, patch, matchPattern)
+		if err != nil {
+			return true, nil, fmt.Errorf("$matches[%d]: %w", i, err)
+		}
+
 		if len(matched) == 0 {
 			return true, nil, fmt.Errorf("$matches[%d] %#v: %w", i, matchPattern, errors.ErrNoMatchFound)
 		}
@@ -130,34 +138,68 @@ func patchMatches(docs []*document.Document, patch *document.Document) (bool, []
 	return true, docs, nil
 }
 
-func findMatches(docs []*document.Document, doc *document.Document, pat any) []*document.Document {
+func findMatches(docs []*document.Document, doc *document.Document, pat any) ([]*document.Document, error) {
 	ret := []*document.Document{}
 
 	parents := findParents(docs, doc)
 	for _, ds := range [][]*document.Document{parents, docs} {
 		for _, d := range ds {
-			if process.MatchDoc(d, pat) {
+			ok, err := process.MatchDoc(d, pat)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
 				ret = append(ret, d)
 			}
 		}
 
 		if len(ret) > 0 {
-			return ret
+			return ret, nil
 		}
 	}
 
-	return nil
+	return nil, nil
+}
+
+func Files(fx fs.FS, files []string, ft *format.Format, env map[string]string, sort []string, redact bool) ([]byte, error) {
+	outputs, err := Outputs(fx, files, env, &ft.Options, sort, redact)
+	if err != nil {
+		return nil, err
+	}
+
+	return ft.MarshalStream(outputs)
 }
 
-func Files(fx fs.FS, files []string, ft *format.Format, env map[string]string, sort []string) ([]byte, error) {
+// Outputs returns the output documents of files. opts may be nil for the
+// default Options. If redact is set, $sensitive and decrypted values are
+// replaced with placeholders.
+func Outputs(fx fs.FS, files []string, env map[string]string, opts *format.Options, sort []string, redact bool) ([]any, error) {
+	outputs, _, err := outputsAndFiles(fx, files, env, opts, sort, redact)
+	return outputs, err
+}
+
+// FileOutputs is Outputs grouped into files by $file, or template for
+// documents without one.
+func FileOutputs(fx fs.FS, files []string, env map[string]string, opts *format.Options, sort []string, template string) ([]*output.File, error) {
+	outputs, names, err := outputsAndFiles(fx, files, env, opts, sort, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Files(outputs, names, template)
+}
+
+// outputsAndFiles returns the output documents and the $file of each.
+func outputsAndFiles(fx fs.FS, files []string, env map[string]string, opts *format.Options, sort []string, redact bool) ([]any, []string, error) {
 	var docs []*document.Document
 	var deferredDocs []*document.Document
 	fileSystem := fsys.New(fx)
 
 	for _, path := range files {
-		fileObjs, err := file.LoadAndParents(fileSystem, path, nil)
+		fileObjs, err := file.LoadAndParents(fileSystem, path, nil, env, opts)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		for _, f := range fileObjs {
@@ -183,15 +225,15 @@ func Files(fx fs.FS, files []string, ft *format.Format, env map[string]string, s
 				Docs:  regularDocs,
 			})
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 		}
 	}
 
 	for _, deferredDoc := range deferredDocs {
-		outputs, err := output.Documents(docs, env)
+		outputs, err := output.Documents(docs, fileSystem, env, redact)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		processedDocs := []*document.Document{}
@@ -202,24 +244,29 @@ func Files(fx fs.FS, files []string, ft *format.Format, env map[string]string, s
 
 		docs, err = Document(processedDocs, deferredDoc)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	outputs, err := output.Documents(docs, env)
+	outputs, err := output.Documents(docs, fileSystem, env, redact)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
+	names := make([]string, len(outputs))
+
 	for i, out := range outputs {
+		names[i], out, err = output.PopFile(out)
+		if err != nil {
+			return nil, nil, err
+		}
+
 		outputs[i] = output.FinalizeOutput(out)
 	}
 
-	if err := sortOutputsByPath(outputs, sort); err != nil {
-		return nil, err
-	}
+	sortOutputsByPath(outputs, names, sort)
 
-	return ft.MarshalStream(outputs)
+	return outputs, names, nil
 }
 
 func FileObj(docs []*document.Document, f *file.File) ([]*document.Document, error) {
@@ -238,19 +285,24 @@ func FileObj(docs []*document.Document, f *file.File) ([]*document.Document, err
 	return docs, nil
 }
 
-func sortOutputsByPath(outputs []any, sortPaths []string) error {
+func sortOutputsByPath(outputs []any, names []string, sortPaths []string) {
 	if len(sortPaths) == 0 {
-		return nil
+		return
+	}
+
+	order := make([]int, len(outputs))
+	for i := range order {
+		order[i] = i
 	}
 
-	sort.SliceStable(outputs, func(i, j int) bool {
+	sort.SliceStable(order, func(i, j int) bool {
 		for _, sortPath := range sortPaths {
-			valI, errI := pathutil.GetString(outputs[i], sortPath)
+			valI, errI := pathutil.GetString(outputs[order[i]], sortPath)
 			if errI != nil {
 				valI = ""
 			}
 
-			valJ, errJ := pathutil.GetString(outputs[j], sortPath)
+			valJ, errJ := pathutil.GetString(outputs[order[j]], sortPath)
 			if errJ != nil {
 				valJ = ""
 			}
@@ -261,5 +313,15 @@ func sortOutputsByPath(outputs []any, sortPaths []string) error {
 		}
 		return false
 	})
-	return nil
+
+	sortedOutputs := make([]any, len(outputs))
+	sortedNames := make([]string, len(names))
+
+	for i, o := range order {
+		sortedOutputs[i] = outputs[o]
+		sortedNames[i] = names[o]
+	}
+
+	copy(outputs, sortedOutputs)
+	copy(names, sortedNames)
 }
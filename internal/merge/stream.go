@@ -0,0 +1,172 @@
+package merge
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/file"
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/output"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Stream evaluates files like Outputs, but reads, merges and writes the
+// documents of the last file one at a time. Streamed documents that patch
+// earlier documents (from other files and parent layers) are merged into
+// them, and those are written at the end. Other streamed documents are
+// written as they're read, after the earlier documents; patching an earlier
+// document once that has happened is an error, since it would change output
+// that was already written. Streamed documents can't reference or patch each
+// other.
+func Stream(fx fs.FS, files []string, env map[string]string, opts *format.Options, enc format.Encoder) error {
+	fileSystem := fsys.New(fx)
+	var docs []*document.Document
+
+	for _, path := range files[:len(files)-1] {
+		fileObjs, err := file.LoadAndParents(fileSystem, path, nil, env, opts)
+		if err != nil {
+			return err
+		}
+
+		docs, err = streamBase(docs, fileObjs)
+		if err != nil {
+			return err
+		}
+	}
+
+	s, err := file.OpenStream(fileSystem, files[len(files)-1], opts)
+	if err != nil {
+		return err
+	}
+
+	defer s.Close()
+
+	parents, err := s.LoadParents(fileSystem, env, opts)
+	if err != nil {
+		return err
+	}
+
+	docs, err = streamBase(docs, parents)
+	if err != nil {
+		return err
+	}
+
+	written := false
+
+	for {
+		doc, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		merged, err := streamDocument(docs, doc)
+		if err != nil {
+			return err
+		}
+
+		if len(merged) == len(docs) {
+			if written {
+				return fmt.Errorf("[%s] patches documents that were already written: %w", doc, errors.ErrStreamUnsupported)
+			}
+
+			continue
+		}
+
+		if !written {
+			err = encodeAll(docs, fileSystem, env, enc)
+			if err != nil {
+				return err
+			}
+
+			written = true
+		}
+
+		err = encodeOutputs(merged, merged[len(merged)-1], fileSystem, env, enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if written {
+		return nil
+	}
+
+	return encodeAll(docs, fileSystem, env, enc)
+}
+
+func streamBase(docs []*document.Document, files []*file.File) ([]*document.Document, error) {
+	for _, f := range files {
+		for _, doc := range f.Docs {
+			if doc.PopMapBoolValue("$defer", true) {
+				return nil, fmt.Errorf("[%s:%s] $defer: %w", f, doc, errors.ErrStreamUnsupported)
+			}
+		}
+
+		var err error
+
+		docs, err = FileObj(docs, f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
+
+// streamDocument merges doc into docs. The result is longer than docs if doc
+// was added rather than patching existing documents.
+func streamDocument(docs []*document.Document, doc *document.Document) ([]*document.Document, error) {
+	if found, _ := doc.PopMapValue("$parent"); found {
+		return nil, fmt.Errorf("[%s] $parent: %w", doc, errors.ErrStreamUnsupported)
+	}
+
+	if doc.PopMapBoolValue("$defer", true) {
+		return nil, fmt.Errorf("[%s] $defer: %w", doc, errors.ErrStreamUnsupported)
+	}
+
+	merged, err := Document(docs, doc)
+	if err != nil {
+		return nil, fmt.Errorf("[%s]: %w", doc, err)
+	}
+
+	return merged, nil
+}
+
+func encodeAll(docs []*document.Document, fsys fs.FS, env map[string]string, enc format.Encoder) error {
+	for _, doc := range docs {
+		err := encodeOutputs(docs, doc, fsys, env, enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeOutputs(docs []*document.Document, doc *document.Document, fsys fs.FS, env map[string]string, enc format.Encoder) error {
+	outs, err := output.Document(docs, doc, fsys, env, false)
+	if err != nil {
+		return err
+	}
+
+	for _, out := range outs {
+		_, out, err := output.PopFile(out)
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(output.FinalizeOutput(out))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
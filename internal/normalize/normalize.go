@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/gopatchy/bkl/internal/format"
 	"github.com/gopatchy/bkl/internal/utils"
 	"github.com/gopatchy/bkl/pkg/errors"
 )
@@ -50,13 +51,5 @@ func normalizeList(obj []any) ([]any, error) {
 }
 
 func normalizeNumber(obj json.Number) (any, error) {
-	if num, err := obj.Int64(); err == nil {
-		if num == int64(int(num)) {
-			return int(num), nil
-		} else {
-			return num, nil
-		}
-	}
-
-	return obj.Float64()
+	return format.ParseNumber(string(obj))
 }
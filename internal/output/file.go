@@ -0,0 +1,103 @@
+package output
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// File is the output documents routed to one path.
+type File struct {
+	Path string
+	Docs []any
+}
+
+var fileNameRE = regexp.MustCompile(`{.*?}`)
+
+// PopFile removes $file from the root of an output document and returns its
+// value, or "" if it has none.
+func PopFile(obj any) (string, any, error) {
+	m, ok := obj.(map[string]any)
+	if !ok {
+		return "", obj, nil
+	}
+
+	found, v, m := utils.PopMapValue(m, "$file")
+	if !found {
+		return "", obj, nil
+	}
+
+	name, ok := v.(string)
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("$file: %#v: %w", v, errors.ErrInvalidFilename)
+	}
+
+	return name, m, nil
+}
+
+// FileName replaces each {path} in template with that value from obj. The
+// result must be a relative path that stays below the output directory.
+func FileName(template string, obj any) (string, error) {
+	var err error
+
+	name := fileNameRE.ReplaceAllStringFunc(template, func(m string) string {
+		if err != nil {
+			return ""
+		}
+
+		var v string
+
+		v, err = pathutil.GetString(obj, strings.TrimSuffix(strings.TrimPrefix(m, "{"), "}"))
+
+		return v
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", template, err)
+	}
+
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%s: %w", name, errors.ErrInvalidFilename)
+	}
+
+	return filepath.Clean(name), nil
+}
+
+// Files groups outputs by file name: names[i] (from $file) if set, otherwise
+// template. Files are in the order their first document appears.
+func Files(outputs []any, names []string, template string) ([]*File, error) {
+	ret := []*File{}
+	byPath := map[string]*File{}
+
+	for i, out := range outputs {
+		tmpl := names[i]
+		if tmpl == "" {
+			tmpl = template
+		}
+
+		if tmpl == "" {
+			return nil, fmt.Errorf("output document %d has no $file and no file template: %w", i, errors.ErrMissingFile)
+		}
+
+		name, err := FileName(tmpl, out)
+		if err != nil {
+			return nil, fmt.Errorf("output document %d: %w", i, err)
+		}
+
+		f := byPath[name]
+		if f == nil {
+			f = &File{Path: name}
+			byPath[name] = f
+			ret = append(ret, f)
+		}
+
+		f.Docs = append(f.Docs, out)
+	}
+
+	return ret, nil
+}
@@ -1,6 +1,8 @@
 package output
 
 import (
+	"io/fs"
+
 	"github.com/gopatchy/bkl/internal/document"
 	"github.com/gopatchy/bkl/internal/format"
 	"github.com/gopatchy/bkl/internal/process"
@@ -8,8 +10,10 @@ import (
 )
 
 // Document returns the output objects generated by the specified document.
-func Document(docs []*document.Document, doc *document.Document, env map[string]string) ([]any, error) {
-	processedDocs, err := process.Document(doc, docs, env)
+// If redact is set, $sensitive and decrypted values are replaced with
+// placeholders.
+func Document(docs []*document.Document, doc *document.Document, fsys fs.FS, env map[string]string, redact bool) ([]any, error) {
+	processedDocs, err := process.Document(doc, docs, fsys, env, redact)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +43,12 @@ func Document(docs []*document.Document, doc *document.Document, env map[string]
 			return nil, nil
 		}
 
-		err = process.Validate(v2)
+		_, v3, err := PopFile(v2)
+		if err != nil {
+			return nil, err
+		}
+
+		err = process.Validate(v3)
 		if err != nil {
 			return nil, err
 		}
@@ -49,11 +58,11 @@ func Document(docs []*document.Document, doc *document.Document, env map[string]
 }
 
 // Documents returns the output objects generated by all documents.
-func Documents(docs []*document.Document, env map[string]string) ([]any, error) {
+func Documents(docs []*document.Document, fsys fs.FS, env map[string]string, redact bool) ([]any, error) {
 	ret := []any{}
 
 	for _, doc := range docs {
-		outs, err := Document(docs, doc, env)
+		outs, err := Document(docs, doc, fsys, env, redact)
 		if err != nil {
 			return nil, err
 		}
@@ -65,8 +74,8 @@ func Documents(docs []*document.Document, env map[string]string) ([]any, error)
 }
 
 // Bytes returns all documents encoded in the specified format and merged into a stream.
-func Bytes(docs []*document.Document, ft *format.Format, env map[string]string) ([]byte, error) {
-	outs, err := Documents(docs, env)
+func Bytes(docs []*document.Document, ft *format.Format, fsys fs.FS, env map[string]string) ([]byte, error) {
+	outs, err := Documents(docs, fsys, env, false)
 	if err != nil {
 		return nil, err
 	}
@@ -2,12 +2,15 @@ package pathutil
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/gopatchy/bkl/pkg/errors"
 )
 
 // Get retrieves a value from a nested structure using a slice of path parts.
+// Parts index into maps by key and into lists by position (negative counts
+// from the end) or by [key=value] selector.
 // It returns an error if the path is not found or cannot be traversed.
 func Get(data any, parts []string) (any, error) {
 	if len(parts) == 0 {
@@ -21,39 +24,35 @@ func Get(data any, parts []string) (any, error) {
 			return nil, fmt.Errorf("%v: %w", parts, errors.ErrRefNotFound)
 		}
 		return Get(val, parts[1:])
+	case []any:
+		i, err := ListIndex(obj, parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", parts, err)
+		}
+		return Get(obj[i], parts[1:])
 	default:
 		return nil, fmt.Errorf("%v: %w", parts, errors.ErrRefNotFound)
 	}
 }
 
-// GetString retrieves a value from a nested structure using a dot-separated path string
+// GetString retrieves a value from a nested structure using a path string
 // and converts it to a string. Returns an error if the path is not found or cannot be traversed.
 func GetString(data any, path string) (string, error) {
 	if path == "" {
 		return "", nil
 	}
 
-	parts := strings.Split(path, ".")
-	current := data
-
-	for _, part := range parts {
-		switch obj := current.(type) {
-		case map[string]any:
-			val, found := obj[part]
-			if !found {
-				return "", fmt.Errorf("key %q not found in path %q: %w", part, path, errors.ErrRefNotFound)
-			}
-			current = val
-		default:
-			return "", fmt.Errorf("cannot traverse %q in non-map type %T: %w", part, current, errors.ErrRefNotFound)
-		}
+	val, err := Get(data, SplitPath(path))
+	if err != nil {
+		return "", fmt.Errorf("%q: %w", path, err)
 	}
 
-	return fmt.Sprint(current), nil
+	return fmt.Sprint(val), nil
 }
 
 // Set sets a value at a path in a nested map structure.
-// It creates intermediate maps as needed.
+// It creates intermediate maps as needed. A [key=value] part creates or
+// reuses a matching list entry.
 func Set(data map[string]any, parts []string, value any) {
 	if len(parts) == 0 {
 		return
@@ -64,6 +63,11 @@ func Set(data map[string]any, parts []string, value any) {
 		return
 	}
 
+	if list, ok := data[parts[0]].([]any); ok || isSelector(parts[1]) {
+		data[parts[0]] = setList(list, parts[1:], value)
+		return
+	}
+
 	if _, exists := data[parts[0]]; !exists {
 		data[parts[0]] = map[string]any{}
 	}
@@ -73,10 +77,197 @@ func Set(data map[string]any, parts []string, value any) {
 	}
 }
 
-// SplitPath splits a dot-separated path string into parts.
+func setList(list []any, parts []string, value any) []any {
+	i, err := ListIndex(list, parts[0])
+	if err != nil {
+		entry := map[string]any{}
+
+		if k, v, ok := parseSelector(parts[0]); ok {
+			entry[k] = v
+		}
+
+		list = append(list, entry)
+		i = len(list) - 1
+	}
+
+	if len(parts) == 1 {
+		list[i] = value
+		return list
+	}
+
+	if next, ok := list[i].(map[string]any); ok {
+		Set(next, parts[1:], value)
+	}
+
+	return list
+}
+
+// SplitPath splits a dot-separated path string into parts. Bracketed
+// segments ([0], [-1], [name=web]) may follow a key without a dot. Keys
+// containing dots can be quoted (labels["app.kubernetes.io/name"]) or
+// escaped (labels.app\.kubernetes\.io/name).
 func SplitPath(path string) []string {
 	if path == "" {
 		return nil
 	}
-	return strings.Split(path, ".")
+
+	parts := []string{}
+	cur := strings.Builder{}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 < len(path) {
+				i++
+			}
+
+			cur.WriteByte(path[i])
+
+		case '.':
+			if cur.Len() > 0 || i == 0 || path[i-1] != ']' {
+				parts = append(parts, cur.String())
+			}
+			cur.Reset()
+
+		case '[':
+			seg, n, ok := splitBracket(path[i:])
+			if !ok {
+				cur.WriteString(path[i:])
+				i = len(path)
+				continue
+			}
+
+			if cur.Len() > 0 {
+				parts = append(parts, cur.String())
+				cur.Reset()
+			}
+
+			parts = append(parts, seg)
+			i += n - 1
+
+		default:
+			cur.WriteByte(c)
+		}
+	}
+
+	if cur.Len() > 0 || path[len(path)-1] != ']' {
+		parts = append(parts, cur.String())
+	}
+
+	return parts
+}
+
+// splitBracket parses a leading [...] segment and returns the part and the
+// number of bytes consumed.
+func splitBracket(s string) (string, int, bool) {
+	if len(s) > 1 && (s[1] == '"' || s[1] == '\'') {
+		q := s[1]
+
+		for j := 2; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+
+			case q:
+				if j+1 >= len(s) || s[j+1] != ']' {
+					return "", 0, false
+				}
+
+				return unquote(s[1 : j+1]), j + 2, true
+			}
+		}
+
+		return "", 0, false
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end == -1 {
+		return "", 0, false
+	}
+
+	seg := s[1:end]
+	if _, err := strconv.Atoi(seg); err != nil {
+		seg = "[" + seg + "]"
+	}
+
+	return seg, end + 1, true
+}
+
+func unquote(s string) string {
+	if s[0] == '"' {
+		if ret, err := strconv.Unquote(s); err == nil {
+			return ret
+		}
+	}
+
+	inner := s[1 : len(s)-1]
+	ret := strings.Builder{}
+
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+		}
+
+		ret.WriteByte(inner[i])
+	}
+
+	return ret.String()
+}
+
+// ListIndex returns the position in list that part, an index or [key=value]
+// selector, refers to.
+func ListIndex(list []any, part string) (int, error) {
+	if k, v, ok := parseSelector(part); ok {
+		for i, entry := range list {
+			entryMap, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			if val, found := entryMap[k]; found && fmt.Sprint(val) == v {
+				return i, nil
+			}
+		}
+
+		return 0, fmt.Errorf("%s: %w", part, errors.ErrRefNotFound)
+	}
+
+	i, err := strconv.Atoi(part)
+	if err != nil {
+		return 0, fmt.Errorf("%s in list: %w", part, errors.ErrRefNotFound)
+	}
+
+	if i < 0 {
+		i += len(list)
+	}
+
+	if i < 0 || i >= len(list) {
+		return 0, fmt.Errorf("%s of %d entries: %w", part, len(list), errors.ErrInvalidIndex)
+	}
+
+	return i, nil
+}
+
+func isSelector(part string) bool {
+	_, _, ok := parseSelector(part)
+	return ok
+}
+
+func parseSelector(part string) (string, string, bool) {
+	inner, ok := strings.CutPrefix(part, "[")
+	if !ok {
+		return "", "", false
+	}
+
+	inner, ok = strings.CutSuffix(inner, "]")
+	if !ok {
+		return "", "", false
+	}
+
+	k, v, ok := strings.Cut(inner, "=")
+	if ok && len(v) > 1 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		v = unquote(v)
+	}
+
+	return k, v, ok
 }
@@ -2,16 +2,36 @@ package process
 
 import (
 	"fmt"
+	"io/fs"
 	"maps"
+	"slices"
+
+	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/redact"
 
 	"github.com/gopatchy/bkl/pkg/errors"
 )
 
 type evalContext struct {
 	Vars map[string]any
+
+	// FS is where $decode reads key files.
+	FS fs.FS
+
+	// Redact replaces sensitive and decrypted values with placeholders.
+	Redact bool
+
+	// Sensitive is the paths of the document's sensitive values, and path
+	// is that of the value being processed, in the same form.
+	Sensitive *redact.Set
+	path      []string
+
+	// redacting is set while processing a value that will be redacted as a
+	// whole.
+	redacting bool
 }
 
-func newEvalContext(env map[string]string) *evalContext {
+func newEvalContext(fsys fs.FS, env map[string]string, sensitive *redact.Set, redact bool) *evalContext {
 	vars := map[string]any{}
 
 	for k, v := range env {
@@ -19,16 +39,66 @@ func newEvalContext(env map[string]string) *evalContext {
 	}
 
 	return &evalContext{
-		Vars: vars,
+		Vars:      vars,
+		FS:        fsys,
+		Redact:    redact,
+		Sensitive: sensitive,
 	}
 }
 
 func (ec *evalContext) clone() *evalContext {
 	return &evalContext{
-		Vars: maps.Clone(ec.Vars),
+		Vars:      maps.Clone(ec.Vars),
+		Redact:    ec.Redact,
+		Sensitive: ec.Sensitive,
+		path:      slices.Clone(ec.path),
+		redacting: ec.redacting,
 	}
 }
 
+// push moves the path of the value being processed into map key k.
+func (ec *evalContext) push(k string) {
+	ec.path = append(ec.path, k)
+}
+
+// pop undoes push.
+func (ec *evalContext) pop() {
+	ec.path = ec.path[:len(ec.path)-1]
+}
+
+// sensitive reports whether the value being processed should be redacted as
+// a whole.
+func (ec *evalContext) sensitive() bool {
+	return ec.Redact && !ec.redacting && ec.Sensitive.Contains(ec.path)
+}
+
+// copyFrom marks the value being processed as sensitive where v, copied from
+// path in doc, is.
+func (ec *evalContext) copyFrom(doc *document.Document, path []string, v any) {
+	if !ec.Redact {
+		return
+	}
+
+	sub := doc.Sensitive.Sub(redact.KeyPath(doc.Data, path))
+
+	// Keys that v is merged with aren't sensitive
+	if m, ok := v.(map[string]any); ok && sub.Contains(nil) {
+		sub = &redact.Set{}
+
+		for k := range m {
+			sub.Add([]string{k})
+		}
+	}
+
+	ec.Sensitive.Graft(ec.path, sub)
+}
+
+// getenv returns the environment variable name, or "" if it isn't set.
+func (ec *evalContext) getenv(name string) string {
+	v, _ := ec.Vars[fmt.Sprintf("$env:%s", name)].(string)
+	return v
+}
+
 func (ec *evalContext) getVar(name string) (any, error) {
 	v, found := ec.Vars[name]
 	if found {
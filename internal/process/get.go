@@ -2,12 +2,14 @@ package process
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/gopatchy/bkl/internal/document"
 	pathutil "github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/redact"
 	"github.com/gopatchy/bkl/internal/utils"
 	"github.com/gopatchy/bkl/pkg/errors"
-	"gopkg.in/yaml.v3"
+	"go.yaml.in/yaml/v3"
 )
 
 func getWithVar(doc *document.Document, docs []*document.Document, ec *evalContext, m any) (any, error) {
@@ -26,22 +28,61 @@ func getWithVar(doc *document.Document, docs []*document.Document, ec *evalConte
 }
 
 func get(doc *document.Document, docs []*document.Document, m any) (any, error) {
+	doc, path, err := ref(doc, docs, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return pathutil.Get(doc.Data, path)
+}
+
+// getCopy is get for a value that's copied into the one being processed,
+// which becomes sensitive where the copied value is.
+func getCopy(doc *document.Document, docs []*document.Document, ec *evalContext, m any) (any, error) {
+	doc, path, err := ref(doc, docs, m)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := pathutil.Get(doc.Data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	ec.copyFrom(doc, path, ret)
+
+	return ret, nil
+}
+
+// refSensitive reports whether the value that m refers to is or contains a
+// sensitive value.
+func refSensitive(doc *document.Document, docs []*document.Document, m any) bool {
+	doc, path, err := ref(doc, docs, m)
+	if err != nil {
+		return false
+	}
+
+	return doc.Sensitive.Sub(redact.KeyPath(doc.Data, path)) != nil
+}
+
+// ref returns the document and path that the reference m points to.
+func ref(doc *document.Document, docs []*document.Document, m any) (*document.Document, []string, error) {
 	switch m2 := m.(type) {
 	case string:
-		return getPathFromString(doc.Data, docs, m2)
+		return refFromString(doc, docs, m2)
 
 	case []any:
-		return getPathFromList(doc.Data, docs, m2)
+		return refFromList(doc, docs, m2)
 
 	case map[string]any:
-		return getCross(docs, m2)
+		return refCross(docs, m2)
 
 	default:
-		return nil, fmt.Errorf("%T as reference: %w", m, errors.ErrInvalidType)
+		return nil, nil, fmt.Errorf("%T as reference: %w", m, errors.ErrInvalidType)
 	}
 }
 
-func getPathFromList(obj any, docs []*document.Document, path []any) (any, error) {
+func refFromList(doc *document.Document, docs []*document.Document, path []any) (*document.Document, []string, error) {
 	if len(path) > 0 {
 		var pat any
 
@@ -54,67 +95,81 @@ func getPathFromList(obj any, docs []*document.Document, path []any) (any, error
 		if ok {
 			path = path[1:]
 
-			doc, err := getCrossDoc(docs, pat)
+			var err error
+
+			doc, err = getCrossDoc(docs, pat)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-
-			obj = doc.Data
 		}
 	}
 
-	path2, err := utils.ToStringList(path)
-	if err != nil {
-		return nil, fmt.Errorf("%v: %w", path, err)
+	path2 := []string{}
+
+	for _, p := range path {
+		switch p2 := p.(type) {
+		case string:
+			path2 = append(path2, p2)
+
+		case int:
+			path2 = append(path2, strconv.Itoa(p2))
+
+		default:
+			return nil, nil, fmt.Errorf("%v: %T: %w", path, p, errors.ErrInvalidType)
+		}
 	}
 
-	return pathutil.Get(obj, path2)
+	return doc, path2, nil
 }
 
-func getPathFromString(obj any, docs []*document.Document, path string) (any, error) {
+func refFromString(doc *document.Document, docs []*document.Document, path string) (*document.Document, []string, error) {
 	var path2 any
 	err := yaml.Unmarshal([]byte(path), &path2)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	switch path3 := path2.(type) {
 	case string:
-		parts := pathutil.SplitPath(path3)
-		return pathutil.Get(obj, parts)
+		return doc, pathutil.SplitPath(path3), nil
 
 	case []any:
-		return getPathFromList(obj, docs, path3)
+		return refFromList(doc, docs, path3)
 
 	default:
-		return nil, fmt.Errorf("%T as reference: %w", path2, errors.ErrInvalidType)
+		return nil, nil, fmt.Errorf("%T as reference: %w", path2, errors.ErrInvalidType)
 	}
 }
 
-func getCross(docs []*document.Document, conf map[string]any) (any, error) {
+func refCross(docs []*document.Document, conf map[string]any) (*document.Document, []string, error) {
 	found, pat, _ := utils.PopMapValue(conf, "$match")
 	if !found {
-		return nil, fmt.Errorf("%#v: %w", conf, errors.ErrMissingMatch)
+		return nil, nil, fmt.Errorf("%#v: %w", conf, errors.ErrMissingMatch)
 	}
 
 	doc, err := getCrossDoc(docs, pat)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	found, path, _ := utils.PopMapValue(conf, "$path")
 	if found {
-		return get(doc, docs, path)
+		return ref(doc, docs, path)
 	}
 
-	return doc.Data, nil
+	return doc, []string{}, nil
 }
 
 func getCrossDoc(docs []*document.Document, pat any) (*document.Document, error) {
 	var ret *document.Document
 
 	for _, doc := range docs {
-		if MatchDoc(doc, pat) {
+		ok, err := MatchDoc(doc, pat)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
 			if ret != nil {
 				return nil, fmt.Errorf("%#v: %w", pat, errors.ErrMultiMatch)
 			}
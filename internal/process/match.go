@@ -1,15 +1,24 @@
 package process
 
 import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+
 	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/format"
 	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
 )
 
-func MatchDoc(doc *document.Document, pat any) bool {
+var matchOps = []string{"$regex", "$glob", "$exists", "$in", "$gt", "$lt", "$any", "$all", "$type"}
+
+func MatchDoc(doc *document.Document, pat any) (bool, error) {
 	return match(doc.Data, pat)
 }
 
-func match(obj any, pat any) bool {
+func match(obj any, pat any) (bool, error) {
 	switch pat2 := pat.(type) {
 	case map[string]any:
 		return matchMap(obj, pat2)
@@ -18,59 +27,295 @@ func match(obj any, pat any) bool {
 		return matchList(obj, pat2)
 
 	default:
-		return obj == pat
+		return obj == pat, nil
 	}
 }
 
-func matchMap(obj any, pat map[string]any) bool {
+func matchMap(obj any, pat map[string]any) (bool, error) {
 	invert, pat := utils.PopMapBoolValue(pat, "$invert", true)
 	if invert {
-		return !matchMap(obj, pat)
+		ok, err := matchMap(obj, pat)
+		return !ok, err
+	}
+
+	pat, hasOps, ok, err := matchOperators(obj, pat)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	if hasOps && len(pat) == 0 {
+		return true, nil
 	}
 
 	objMap, ok := obj.(map[string]any)
 	if !ok {
-		return false
+		return false, nil
 	}
 
 	if len(objMap) == 1 {
 		for k := range objMap {
 			if k == "$merge" || k == "$replace" || k == "$encode" {
-				return false
+				return false, nil
 			}
 		}
 	}
 
 	for pk, pv := range pat {
-		if !match(objMap[pk], pv) {
-			return false
+		ov, present := objMap[pk]
+
+		if pvMap, ok := pv.(map[string]any); ok {
+			found, exists, pvMap := utils.PopMapValue(pvMap, "$exists")
+			if found {
+				exists2, ok := exists.(bool)
+				if !ok {
+					return false, fmt.Errorf("$exists: %T (%w)", exists, errors.ErrInvalidType)
+				}
+
+				if exists2 != present {
+					return false, nil
+				}
+
+				if len(pvMap) == 0 {
+					continue
+				}
+
+				pv = pvMap
+			}
+		}
+
+		ok, err := match(ov, pv)
+		if err != nil || !ok {
+			return false, err
 		}
 	}
 
-	return true
+	return true, nil
 }
 
-func matchList(obj any, pat []any) bool {
+// matchOperators checks the predicate operators in pat against obj and
+// returns pat with them removed.
+func matchOperators(obj any, pat map[string]any) (map[string]any, bool, bool, error) {
+	rest := map[string]any{}
+	ops := []string{}
+
+	for k, v := range pat {
+		if slices.Contains(matchOps, k) {
+			ops = append(ops, k)
+		} else {
+			rest[k] = v
+		}
+	}
+
+	slices.Sort(ops)
+
+	for _, k := range ops {
+		ok, err := matchOperator(obj, k, pat[k])
+		if err != nil {
+			return nil, true, false, fmt.Errorf("%s: %w", k, err)
+		}
+
+		if !ok {
+			return rest, true, false, nil
+		}
+	}
+
+	return rest, len(ops) > 0, true, nil
+}
+
+func matchOperator(obj any, op string, arg any) (bool, error) {
+	switch op {
+	case "$regex":
+		expr, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w (%w)", expr, err, errors.ErrInvalidArguments)
+		}
+
+		s, ok := obj.(string)
+
+		return ok && re.MatchString(s), nil
+
+	case "$glob":
+		expr, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		s, ok := obj.(string)
+		if !ok {
+			s = ""
+		}
+
+		matched, err := path.Match(expr, s)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w (%w)", expr, err, errors.ErrInvalidArguments)
+		}
+
+		return ok && matched, nil
+
+	case "$exists":
+		exists, ok := arg.(bool)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		return exists == (obj != nil), nil
+
+	case "$in":
+		vals, ok := arg.([]any)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		for _, v := range vals {
+			switch v.(type) {
+			case map[string]any, []any:
+				return false, fmt.Errorf("%T (%w)", v, errors.ErrInvalidType)
+			}
+
+			if obj == v {
+				return true, nil
+			}
+		}
+
+		return false, nil
+
+	case "$gt", "$lt":
+		arg2, ok := utils.ToFloat(arg)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		obj2, ok := utils.ToFloat(obj)
+		if !ok {
+			return false, nil
+		}
+
+		if op == "$gt" {
+			return obj2 > arg2, nil
+		}
+
+		return obj2 < arg2, nil
+
+	case "$any", "$all":
+		pats, ok := arg.([]any)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		for _, p := range pats {
+			ok, err := match(obj, p)
+			if err != nil {
+				return false, err
+			}
+
+			if ok && op == "$any" {
+				return true, nil
+			}
+
+			if !ok && op == "$all" {
+				return false, nil
+			}
+		}
+
+		return op == "$all", nil
+
+	case "$type":
+		t, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("%T (%w)", arg, errors.ErrInvalidType)
+		}
+
+		return matchType(obj, t)
+
+	default:
+		return false, fmt.Errorf("%s: %w", op, errors.ErrInvalidArguments)
+	}
+}
+
+func matchType(obj any, t string) (bool, error) {
+	switch t {
+	case "string":
+		_, ok := obj.(string)
+		return ok, nil
+
+	case "int":
+		switch v := obj.(type) {
+		case int, int64:
+			return true, nil
+
+		case format.Number:
+			return v.IsInt(), nil
+		}
+
+		return false, nil
+
+	case "float":
+		switch v := obj.(type) {
+		case float64:
+			return true, nil
+
+		case format.Number:
+			return !v.IsInt(), nil
+		}
+
+		return false, nil
+
+	case "number":
+		_, ok := utils.ToFloat(obj)
+		return ok, nil
+
+	case "bool":
+		_, ok := obj.(bool)
+		return ok, nil
+
+	case "map":
+		_, ok := obj.(map[string]any)
+		return ok, nil
+
+	case "list":
+		_, ok := obj.([]any)
+		return ok, nil
+
+	case "null":
+		return obj == nil, nil
+
+	default:
+		return false, fmt.Errorf("%s (%w)", t, errors.ErrInvalidArguments)
+	}
+}
+
+func matchList(obj any, pat []any) (bool, error) {
 	objList, ok := obj.([]any)
 	if !ok {
-		return false
+		return false, nil
 	}
 
 	for _, pv := range pat {
-		if !matchListSingle(objList, pv) {
-			return false
+		ok, err := matchListSingle(objList, pv)
+		if err != nil || !ok {
+			return false, err
 		}
 	}
 
-	return true
+	return true, nil
 }
 
-func matchListSingle(obj []any, pat any) bool {
+func matchListSingle(obj []any, pat any) (bool, error) {
 	for _, ov := range obj {
-		if match(ov, pat) {
-			return true
+		ok, err := match(ov, pat)
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			return true, nil
 		}
 	}
 
-	return false
+	return false, nil
 }
@@ -2,6 +2,8 @@ package process
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/gopatchy/bkl/internal/document"
 
@@ -21,6 +23,7 @@ func MergeDocs(doc, patch *document.Document) error {
 	}
 
 	doc.Data = merged
+	doc.Sensitive.Merge(patch.Sensitive)
 	patch.Parents = append(patch.Parents, doc)
 
 	return nil
@@ -51,6 +54,15 @@ func mergeMap(dst map[string]any, src any) (any, error) {
 	case map[string]any:
 		return mergeMapMap(dst, src2)
 
+	case []any:
+		// A layer with repeated entries where the parent had one, as XML
+		// reads them: the parent's becomes the first
+		if utils.IsListOfMaps(src2) {
+			return mergeListList([]any{dst}, src2)
+		}
+
+		return src, nil
+
 	default:
 		return src, nil
 	}
@@ -100,6 +112,21 @@ func mergeList(dst []any, src any) (any, error) {
 	case []any:
 		return mergeListList(dst, src2)
 
+	case map[string]any:
+		// A layer with one entry where the parent had several, as XML reads
+		// them: it's merged as a one-entry list unless it replaces the list
+		replace, found := utils.GetMapBoolValue(src2, "$replace")
+		if found && replace {
+			delete(src2, "$replace")
+			return src2, nil
+		}
+
+		if utils.IsListOfMaps(dst) {
+			return mergeListList(dst, []any{src2})
+		}
+
+		return src, nil
+
 	default:
 		return src, nil
 	}
@@ -122,10 +149,41 @@ func mergeListList(dst []any, src []any) ([]any, error) {
 
 	_, dst = utils.PopListString(dst, "$required")
 
+	key, dst, src, err := mergeListMarker(dst, src, "$key")
+	if err != nil {
+		return nil, err
+	}
+
+	unique, dst, src, err := mergeListMarker(dst, src, "$unique")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := listKeyFields(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prepend, src, err := utils.PopListMapBoolValue(src, "$prepend", true)
+	if err != nil {
+		return nil, err
+	}
+
+	prependAt := 0
+
+	add := func(v any) {
+		if prepend {
+			dst = slices.Insert(dst, prependAt, v)
+			prependAt++
+		} else {
+			dst = append(dst, v)
+		}
+	}
+
 	for _, v := range src {
 		vMap, ok := v.(map[string]any)
 		if !ok {
-			dst = append(dst, v)
+			add(v)
 			continue
 		}
 
@@ -170,19 +228,182 @@ func mergeListList(dst []any, src []any) ([]any, error) {
 			continue
 		}
 
-		dst = append(dst, v)
+		found, idx, vMap := utils.PopMapValue(vMap, "$index")
+		if found {
+			dst, err = mergeListIndex(dst, idx, vMap)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		found, before, vMap := utils.PopMapValue(vMap, "$insertBefore")
+		if found {
+			dst, err = mergeListInsert(dst, before, vMap, 0)
+			if err != nil {
+				return nil, fmt.Errorf("$insertBefore: %w", err)
+			}
+
+			continue
+		}
+
+		found, after, vMap := utils.PopMapValue(vMap, "$insertAfter")
+		if found {
+			dst, err = mergeListInsert(dst, after, vMap, 1)
+			if err != nil {
+				return nil, fmt.Errorf("$insertAfter: %w", err)
+			}
+
+			continue
+		}
+
+		found, vMap = utils.PopMapBoolValue(vMap, "$prepend", true)
+		if found {
+			val, err := listEntryValue(vMap)
+			if err != nil {
+				return nil, err
+			}
+
+			dst = slices.Insert(dst, prependAt, val)
+			prependAt++
+
+			continue
+		}
+
+		if keys != nil {
+			dst, found, err = mergeListKeyed(dst, keys, vMap)
+			if err != nil {
+				return nil, err
+			}
+
+			if !found {
+				add(vMap)
+			}
+
+			continue
+		}
+
+		add(v)
+	}
+
+	if unique != nil {
+		dst = append([]any{map[string]any{"$unique": unique}}, dst...)
+	}
+
+	if key != nil {
+		dst = append([]any{map[string]any{"$key": key}}, dst...)
 	}
 
 	return dst, nil
 }
 
+// mergeListMarker pops a list-level directive from both lists so that it
+// is carried forward once, with the upper layer taking precedence.
+func mergeListMarker(dst []any, src []any, k string) (any, []any, []any, error) {
+	dstVal, dst, err := utils.PopListMapValue(dst, k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	srcVal, src, err := utils.PopListMapValue(src, k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if srcVal != nil {
+		return srcVal, dst, src, nil
+	}
+
+	return dstVal, dst, src, nil
+}
+
+// listKeyFields returns the fields of a $key value, or nil if there's none.
+// There are no default keys, so lists without $key aren't merged by key.
+func listKeyFields(key any) ([]string, error) {
+	switch key2 := key.(type) {
+	case nil:
+		return nil, nil
+
+	case string:
+		return []string{key2}, nil
+
+	case []any:
+		keys, err := utils.ToStringList(key2)
+		if err != nil {
+			return nil, fmt.Errorf("$key: %w", err)
+		}
+
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("$key: empty list (%w)", errors.ErrInvalidArguments)
+		}
+
+		return keys, nil
+
+	default:
+		return nil, fmt.Errorf("$key: %T (%w)", key, errors.ErrInvalidType)
+	}
+}
+
+func mergeListKeyed(obj []any, keys []string, v map[string]any) ([]any, bool, error) {
+	pat := map[string]any{}
+	val := maps.Clone(v)
+	hasKey := false
+
+	for _, k := range keys {
+		kv, found := v[k]
+		if found {
+			hasKey = true
+		}
+
+		pat[k] = kv
+		delete(val, k)
+	}
+
+	if !hasKey {
+		return obj, false, nil
+	}
+
+	found := false
+
+	obj, err := utils.FilterList(obj, func(v2 any) ([]any, error) {
+		ok, err := match(v2, pat)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return []any{v2}, nil
+		}
+
+		found = true
+
+		v3, err := merge(v2, val)
+		if err != nil {
+			return nil, err
+		}
+
+		return []any{v3}, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return obj, found, nil
+}
+
 func mergeListDelete(obj []any, del any) ([]any, error) {
 	var err error
 
 	deleted := false
 
 	obj, err = utils.FilterList(obj, func(v any) ([]any, error) {
-		if match(v, del) {
+		ok, err := match(v, del)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
 			deleted = true
 			return nil, nil
 		}
@@ -201,21 +422,20 @@ func mergeListDelete(obj []any, del any) ([]any, error) {
 }
 
 func mergeListMatch(obj []any, m any, v map[string]any) ([]any, error) {
-	var val any = v
-
-	found, v2, v := utils.PopMapValue(v, "$value")
-	if found {
-		if len(v) > 0 {
-			return nil, fmt.Errorf("%#v: %w", v, errors.ErrExtraKeys)
-		}
-
-		val = v2
+	val, err := listEntryValue(v)
+	if err != nil {
+		return nil, err
 	}
 
-	found = false
+	found := false
 
-	obj, err := utils.FilterList(obj, func(v2 any) ([]any, error) {
-		if match(v2, m) {
+	obj, err = utils.FilterList(obj, func(v2 any) ([]any, error) {
+		ok, err := match(v2, m)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
 			found = true
 
 			v2, err := merge(v2, val)
@@ -238,3 +458,75 @@ func mergeListMatch(obj []any, m any, v map[string]any) ([]any, error) {
 
 	return obj, nil
 }
+
+func mergeListIndex(obj []any, idx any, v map[string]any) ([]any, error) {
+	i, ok := utils.ToInt(idx)
+	if !ok {
+		return nil, fmt.Errorf("$index: %T (%w)", idx, errors.ErrInvalidType)
+	}
+
+	if i < 0 {
+		i += len(obj)
+	}
+
+	if i < 0 || i >= len(obj) {
+		return nil, fmt.Errorf("$index: %v of %d entries (%w)", idx, len(obj), errors.ErrInvalidIndex)
+	}
+
+	val, err := listEntryValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	obj[i], err = merge(obj[i], val)
+	if err != nil {
+		return nil, fmt.Errorf("$index: %v: %w", idx, err)
+	}
+
+	return obj, nil
+}
+
+func mergeListInsert(obj []any, m any, v map[string]any, offset int) ([]any, error) {
+	val, err := listEntryValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := -1
+
+	for i, v2 := range obj {
+		ok, err := match(v2, m)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if pos != -1 {
+			return nil, fmt.Errorf("%#v: %w", m, errors.ErrMultiInsertMatch)
+		}
+
+		pos = i
+	}
+
+	if pos == -1 {
+		return nil, fmt.Errorf("%#v: %w", m, errors.ErrNoInsertMatch)
+	}
+
+	return slices.Insert(obj, pos+offset, val), nil
+}
+
+func listEntryValue(v map[string]any) (any, error) {
+	found, val, v := utils.PopMapValue(v, "$value")
+	if !found {
+		return v, nil
+	}
+
+	if len(v) > 0 {
+		return nil, fmt.Errorf("%#v: %w", v, errors.ErrExtraKeys)
+	}
+
+	return val, nil
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/gopatchy/bkl/pkg/errors"
 )
 
-func process1(obj any, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1(obj any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	depth++
 
 	if depth > 1000 {
@@ -19,38 +19,41 @@ func process1(obj any, mergeFrom *document.Document, mergeFromDocs []*document.D
 
 	switch obj2 := obj.(type) {
 	case map[string]any:
-		return process1Map(obj2, mergeFrom, mergeFromDocs, depth)
+		return process1Map(obj2, mergeFrom, mergeFromDocs, ec, depth)
 
 	case []any:
-		return process1List(obj2, mergeFrom, mergeFromDocs, depth)
+		return process1List(obj2, mergeFrom, mergeFromDocs, ec, depth)
 
 	case string:
-		return process1String(obj2, mergeFrom, mergeFromDocs, depth)
+		return process1String(obj2, mergeFrom, mergeFromDocs, ec, depth)
 
 	default:
 		return obj, nil
 	}
 }
 
-func process1Map(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1Map(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	// Not copying obj before merge preserves the layering behavior that
 	// tests/merge-race relies upon.
 	if v, found := obj["$merge"]; found {
 		delete(obj, "$merge")
-		return process1MapMerge(obj, mergeFrom, mergeFromDocs, v, depth)
+		return process1MapMerge(obj, mergeFrom, mergeFromDocs, ec, v, depth)
 	}
 
 	if found, v, obj := utils.PopMapValue(obj, "$replace"); found {
-		return process1MapReplace(obj, mergeFrom, mergeFromDocs, v, depth)
+		return process1MapReplace(obj, mergeFrom, mergeFromDocs, ec, v, depth)
 	}
 
 	return utils.FilterMap(obj, func(k string, v any) (map[string]any, error) {
-		v2, err := process1(v, mergeFrom, mergeFromDocs, depth)
+		ec.push(k)
+		v2, err := process1(v, mergeFrom, mergeFromDocs, ec, depth)
+		ec.pop()
+
 		if err != nil {
 			return nil, err
 		}
 
-		k2, err := process1(k, mergeFrom, mergeFromDocs, depth)
+		k2, err := process1(k, mergeFrom, mergeFromDocs, ec, depth)
 		if err != nil {
 			return nil, err
 		}
@@ -59,8 +62,8 @@ func process1Map(obj map[string]any, mergeFrom *document.Document, mergeFromDocs
 	})
 }
 
-func process1MapMerge(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, v any, depth int) (any, error) {
-	in, err := get(mergeFrom, mergeFromDocs, v)
+func process1MapMerge(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, v any, depth int) (any, error) {
+	in, err := getCopy(mergeFrom, mergeFromDocs, ec, v)
 	if err != nil {
 		return nil, err
 	}
@@ -70,19 +73,19 @@ func process1MapMerge(obj map[string]any, mergeFrom *document.Document, mergeFro
 		return nil, err
 	}
 
-	return process1(next, mergeFrom, mergeFromDocs, depth)
+	return process1(next, mergeFrom, mergeFromDocs, ec, depth)
 }
 
-func process1MapReplace(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, v any, depth int) (any, error) {
-	next, err := get(mergeFrom, mergeFromDocs, v)
+func process1MapReplace(obj map[string]any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, v any, depth int) (any, error) {
+	next, err := getCopy(mergeFrom, mergeFromDocs, ec, v)
 	if err != nil {
 		return nil, err
 	}
 
-	return process1(next, mergeFrom, mergeFromDocs, depth)
+	return process1(next, mergeFrom, mergeFromDocs, ec, depth)
 }
 
-func process1List(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1List(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	merge := []any{}
 
 	obj, err := utils.FilterList(obj, func(v any) ([]any, error) {
@@ -105,7 +108,7 @@ func process1List(obj []any, mergeFrom *document.Document, mergeFromDocs []*docu
 	})
 
 	for i, m := range merge {
-		result, err := process1ListMerge(obj, mergeFrom, mergeFromDocs, m, depth)
+		result, err := process1ListMerge(obj, mergeFrom, mergeFromDocs, ec, m, depth)
 		if err != nil {
 			return nil, err
 		}
@@ -126,11 +129,11 @@ func process1List(obj []any, mergeFrom *document.Document, mergeFromDocs []*docu
 	}
 
 	if m != nil {
-		return process1ListReplace(obj, mergeFrom, mergeFromDocs, m, depth)
+		return process1ListReplace(obj, mergeFrom, mergeFromDocs, ec, m, depth)
 	}
 
 	return utils.FilterList(obj, func(v any) ([]any, error) {
-		v2, err := process1(v, mergeFrom, mergeFromDocs, depth)
+		v2, err := process1(v, mergeFrom, mergeFromDocs, ec, depth)
 		if err != nil {
 			return nil, err
 		}
@@ -139,8 +142,8 @@ func process1List(obj []any, mergeFrom *document.Document, mergeFromDocs []*docu
 	})
 }
 
-func process1ListMerge(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, m any, depth int) (any, error) {
-	in, err := get(mergeFrom, mergeFromDocs, m)
+func process1ListMerge(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, m any, depth int) (any, error) {
+	in, err := getCopy(mergeFrom, mergeFromDocs, ec, m)
 	if err != nil {
 		return nil, err
 	}
@@ -148,45 +151,45 @@ func process1ListMerge(obj []any, mergeFrom *document.Document, mergeFromDocs []
 	return mergeList(obj, in)
 }
 
-func process1ListReplace(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, m any, depth int) (any, error) {
-	next, err := get(mergeFrom, mergeFromDocs, m)
+func process1ListReplace(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, m any, depth int) (any, error) {
+	next, err := getCopy(mergeFrom, mergeFromDocs, ec, m)
 	if err != nil {
 		return nil, err
 	}
 
-	return process1(next, mergeFrom, mergeFromDocs, depth)
+	return process1(next, mergeFrom, mergeFromDocs, ec, depth)
 }
 
-func process1String(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1String(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	if strings.HasPrefix(obj, "$merge:") {
-		return process1StringMerge(obj, mergeFrom, mergeFromDocs, depth)
+		return process1StringMerge(obj, mergeFrom, mergeFromDocs, ec, depth)
 	}
 
 	if strings.HasPrefix(obj, "$replace:") {
-		return process1StringReplace(obj, mergeFrom, mergeFromDocs, depth)
+		return process1StringReplace(obj, mergeFrom, mergeFromDocs, ec, depth)
 	}
 
 	return obj, nil
 }
 
-func process1StringMerge(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1StringMerge(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	path := strings.TrimPrefix(obj, "$merge:")
 
-	in, err := get(mergeFrom, mergeFromDocs, path)
+	in, err := getCopy(mergeFrom, mergeFromDocs, ec, path)
 	if err != nil {
 		return nil, err
 	}
 
-	return process1(in, mergeFrom, mergeFromDocs, depth)
+	return process1(in, mergeFrom, mergeFromDocs, ec, depth)
 }
 
-func process1StringReplace(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, depth int) (any, error) {
+func process1StringReplace(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
 	path := strings.TrimPrefix(obj, "$replace:")
 
-	in, err := get(mergeFrom, mergeFromDocs, path)
+	in, err := getCopy(mergeFrom, mergeFromDocs, ec, path)
 	if err != nil {
 		return nil, err
 	}
 
-	return process1(in, mergeFrom, mergeFromDocs, depth)
+	return process1(in, mergeFrom, mergeFromDocs, ec, depth)
 }
@@ -13,6 +13,8 @@ import (
 	"github.com/gopatchy/bkl/internal/format"
 	"github.com/gopatchy/bkl/internal/normalize"
 	pathutil "github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/redact"
+	"github.com/gopatchy/bkl/internal/secret"
 	"github.com/gopatchy/bkl/internal/utils"
 	"github.com/gopatchy/bkl/pkg/errors"
 )
@@ -24,6 +26,10 @@ func process2(obj any, mergeFrom *document.Document, mergeFromDocs []*document.D
 		return nil, fmt.Errorf("%#v: %w", obj, errors.ErrCircularRef)
 	}
 
+	if ec.sensitive() {
+		return process2Redacted(obj, mergeFrom, mergeFromDocs, ec, depth)
+	}
+
 	switch obj2 := obj.(type) {
 	case map[string]any:
 		return process2Map(obj2, mergeFrom, mergeFromDocs, ec, depth)
@@ -71,7 +77,10 @@ func process2Map(obj map[string]any, mergeFrom *document.Document, mergeFromDocs
 	}
 
 	return utils.FilterMap(obj, func(k string, v any) (map[string]any, error) {
+		ec.push(k)
 		v2, err := process2(v, mergeFrom, mergeFromDocs, ec, depth)
+		ec.pop()
+
 		if err != nil {
 			return nil, err
 		}
@@ -89,6 +98,20 @@ func process2MapValue(obj map[string]any, mergeFrom *document.Document, mergeFro
 	return process2(v, mergeFrom, mergeFromDocs, ec, depth)
 }
 
+// process2Redacted processes obj, a sensitive value, and replaces it with
+// placeholders.
+func process2Redacted(obj any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
+	ec.redacting = true
+	ret, err := process2(obj, mergeFrom, mergeFromDocs, ec, depth)
+	ec.redacting = false
+
+	if err != nil {
+		return nil, err
+	}
+
+	return redact.Value(ret), nil
+}
+
 func process2Encode(obj any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, v any, depth int) (any, error) {
 	obj2, err := process2(obj, mergeFrom, mergeFromDocs, ec, depth)
 	if err != nil {
@@ -135,6 +158,10 @@ func process2EncodeString(obj any, mergeFrom *document.Document, mergeFromDocs [
 			return nil, fmt.Errorf("$encode: %s: %w", v, errors.ErrInvalidArguments)
 		}
 
+		if bin, ok := obj.(format.Binary); ok {
+			return base64.StdEncoding.EncodeToString([]byte(bin)), nil
+		}
+
 		obj2 := fmt.Sprintf("%v", obj)
 		return base64.StdEncoding.EncodeToString([]byte(obj2)), nil
 
@@ -201,6 +228,23 @@ func process2EncodeString(obj any, mergeFrom *document.Document, mergeFromDocs [
 
 		return ret, nil
 
+	case "sort":
+		if len(parts) != 1 {
+			return nil, fmt.Errorf("$encode: %s: %w", v, errors.ErrInvalidArguments)
+		}
+
+		obj2, ok := obj.([]any)
+		if !ok {
+			return nil, fmt.Errorf("$encode: %s of non-list %T: %w", v, obj, errors.ErrInvalidType)
+		}
+
+		ret, err := utils.SortList(obj2)
+		if err != nil {
+			return nil, fmt.Errorf("$encode: %s: %w", v, err)
+		}
+
+		return ret, nil
+
 	case "sha256":
 		if len(parts) != 1 {
 			return nil, fmt.Errorf("$encode: %s: %w", v, errors.ErrInvalidArguments)
@@ -226,6 +270,18 @@ func process2EncodeString(obj any, mergeFrom *document.Document, mergeFromDocs [
 
 		return process2ToListMap(obj, delim)
 
+	case "unique":
+		if len(parts) != 1 {
+			return nil, fmt.Errorf("$encode: %s: %w", v, errors.ErrInvalidArguments)
+		}
+
+		obj2, ok := obj.([]any)
+		if !ok {
+			return nil, fmt.Errorf("$encode: %s of non-list %T: %w", v, obj, errors.ErrInvalidType)
+		}
+
+		return utils.UniqueList(obj2), nil
+
 	case "values":
 		var nameKey, valueKey string
 
@@ -304,6 +360,28 @@ func process2DecodeStringMap(obj map[string]any, mergeFrom *document.Document, m
 		return nil, fmt.Errorf("$value: %#v (%w)", obj, errors.ErrExtraKeys)
 	}
 
+	if secret.IsMethod(v) {
+		plain, err := secret.Decrypt(ec.FS, v, val2, ec.getenv)
+		if err != nil {
+			return nil, fmt.Errorf("$decode: %w", err)
+		}
+
+		if ec.Redact && !ec.redacting {
+			return redact.Placeholder(plain), nil
+		}
+
+		return plain, nil
+	}
+
+	if v == "base64" {
+		bin, err := base64.StdEncoding.DecodeString(val2)
+		if err != nil {
+			return nil, fmt.Errorf("$decode: %s: %w: %w", v, err, errors.ErrUnmarshal)
+		}
+
+		return format.Binary(bin), nil
+	}
+
 	ft, err := format.Get(v)
 	if err != nil {
 		return nil, err
@@ -324,6 +402,15 @@ func process2DecodeStringMap(obj map[string]any, mergeFrom *document.Document, m
 		return nil, err
 	}
 
+	normalized, sensitive, err := redact.Extract(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	if ec.Redact {
+		ec.Sensitive.Graft(ec.path, sensitive)
+	}
+
 	return process2(normalized, mergeFrom, mergeFromDocs, ec, depth)
 }
 
@@ -374,6 +461,11 @@ func process2ToListValue(k, delim string, v any) string {
 }
 
 func process2List(obj []any, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
+	_, obj, err := utils.PopListMapValue(obj, "$key")
+	if err != nil {
+		return nil, err
+	}
+
 	m, obj, err := utils.PopListMapValue(obj, "$encode")
 	if err != nil {
 		return nil, err
@@ -383,7 +475,12 @@ func process2List(obj []any, mergeFrom *document.Document, mergeFromDocs []*docu
 		return process2Encode(obj, mergeFrom, mergeFromDocs, ec, m, depth)
 	}
 
-	return utils.FilterList(obj, func(v any) ([]any, error) {
+	unique, obj, err := utils.PopListMapValue(obj, "$unique")
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err = utils.FilterList(obj, func(v any) ([]any, error) {
 		switch v2 := v.(type) {
 		case map[string]any:
 			if found, r, v3 := utils.PopMapValue(v2, "$repeat"); found {
@@ -398,6 +495,31 @@ func process2List(obj []any, mergeFrom *document.Document, mergeFromDocs []*docu
 
 		return []any{v2}, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if unique != nil {
+		return process2ListUnique(obj, unique)
+	}
+
+	return obj, nil
+}
+
+func process2ListUnique(obj []any, mode any) ([]any, error) {
+	switch mode {
+	case true:
+		return utils.UniqueList(obj), nil
+
+	case false:
+		return obj, nil
+
+	case "sort":
+		return utils.SortList(utils.UniqueList(obj))
+
+	default:
+		return nil, fmt.Errorf("$unique: %#v: %w", mode, errors.ErrInvalidArguments)
+	}
 }
 
 func process2String(obj string, mergeFrom *document.Document, mergeFromDocs []*document.Document, ec *evalContext, depth int) (any, error) {
@@ -419,6 +541,9 @@ func process2StringInterp(obj string, mergeFrom *document.Document, mergeFromDoc
 
 	var err error
 
+	// A string built from a sensitive value is sensitive too
+	sensitive := false
+
 	obj = interpRE.ReplaceAllStringFunc(obj, func(m string) string {
 		if err != nil {
 			return "{ERROR}"
@@ -433,6 +558,10 @@ func process2StringInterp(obj string, mergeFrom *document.Document, mergeFromDoc
 			return "{ERROR}"
 		}
 
+		if ec.Redact && !ec.redacting && refSensitive(mergeFrom, mergeFromDocs, m) {
+			sensitive = true
+		}
+
 		if v2, ok := v.(string); ok {
 			v, err = process2String(v2, mergeFrom, mergeFromDocs, ec, depth+1)
 			if err != nil {
@@ -447,6 +576,10 @@ func process2StringInterp(obj string, mergeFrom *document.Document, mergeFromDoc
 		return nil, err
 	}
 
+	if sensitive {
+		return redact.Placeholder(obj), nil
+	}
+
 	return obj, nil
 }
 
@@ -509,7 +642,10 @@ func process2RepeatObjMap(v map[string]any, mergeFrom *document.Document, mergeF
 	}
 
 	for _, ctx := range contexts {
+		ctx.push(k)
 		v2, err := process2(v, mergeFrom, mergeFromDocs, ctx, depth)
+		ctx.pop()
+
 		if err != nil {
 			return nil, err
 		}
@@ -1,13 +1,20 @@
 package process
 
-import "github.com/gopatchy/bkl/internal/document"
+import (
+	"io/fs"
 
-func Document(d *document.Document, mergeFromDocs []*document.Document, env map[string]string) ([]*document.Document, error) {
+	"github.com/gopatchy/bkl/internal/document"
+)
+
+// Document processes d. If redact is set, the values at d.Sensitive, those
+// derived from them and decrypted values are replaced with placeholders, for
+// output that's shown rather than used. $decode reads key files from fsys.
+func Document(d *document.Document, mergeFromDocs []*document.Document, fsys fs.FS, env map[string]string, redact bool) ([]*document.Document, error) {
 	var err error
 
-	ec := newEvalContext(env)
+	ec := newEvalContext(fsys, env, d.Sensitive, redact)
 
-	d.Data, err = process1(d.Data, d, mergeFromDocs, 0)
+	d.Data, err = process1(d.Data, d, mergeFromDocs, ec, 0)
 	if err != nil {
 		return nil, err
 	}
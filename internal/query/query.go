@@ -0,0 +1,460 @@
+// Package query evaluates jq-style expressions against evaluated documents.
+//
+// The input to an expression is the list of output documents. Supported
+// stages, separated by |:
+//   - .a.b, .["a.b"], .a\.b: map keys, as in --sort and --redact paths
+//     (missing keys yield null)
+//   - .[N], .[-N]: list index
+//   - .[key=value]: list entry whose key matches value
+//   - .[], .*: all values of a list or map
+//   - select(PATH), select(PATH OP VALUE): filter, where OP is one of
+//     == != < <= > >= and VALUE is a YAML scalar
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+	"go.yaml.in/yaml/v3"
+)
+
+type stage func(any) ([]any, error)
+
+// selector is a [key=value] path part, in pathutil form.
+type selector string
+
+var compareOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// Run evaluates expr against docs and returns the resulting values.
+func Run(expr string, docs []any) ([]any, error) {
+	stages, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := []any{docs}
+
+	for _, st := range stages {
+		next := []any{}
+
+		for _, v := range vals {
+			ret, err := st(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", expr, err)
+			}
+
+			next = append(next, ret...)
+		}
+
+		vals = next
+	}
+
+	return vals, nil
+}
+
+func parse(expr string) ([]stage, error) {
+	parts, err := split(expr, '|')
+	if err != nil {
+		return nil, err
+	}
+
+	stages := []stage{}
+
+	for _, part := range parts {
+		st, err := parseStage(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+
+		stages = append(stages, st)
+	}
+
+	return stages, nil
+}
+
+func parseStage(s string) (stage, error) {
+	if inner, ok := strings.CutPrefix(s, "select("); ok {
+		inner, ok = strings.CutSuffix(inner, ")")
+		if !ok {
+			return nil, fmt.Errorf("%s: unterminated select (%w)", s, errors.ErrInvalidQuery)
+		}
+
+		return parseSelect(strings.TrimSpace(inner))
+	}
+
+	segs, err := parsePath(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(v any) ([]any, error) {
+		return walk(v, segs)
+	}, nil
+}
+
+func parseSelect(s string) (stage, error) {
+	for _, op := range compareOps {
+		i := indexUnquoted(s, op)
+		if i == -1 {
+			continue
+		}
+
+		segs, err := parsePath(strings.TrimSpace(s[:i]))
+		if err != nil {
+			return nil, err
+		}
+
+		var val any
+
+		err = yaml.Unmarshal([]byte(s[i+len(op):]), &val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w (%w)", s, err, errors.ErrInvalidQuery)
+		}
+
+		return func(v any) ([]any, error) {
+			return selectIf(v, segs, func(found any) (bool, error) {
+				return compare(found, op, val)
+			})
+		}, nil
+	}
+
+	segs, err := parsePath(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(v any) ([]any, error) {
+		return selectIf(v, segs, func(found any) (bool, error) {
+			return found != nil && found != false, nil
+		})
+	}, nil
+}
+
+func selectIf(v any, segs []any, cond func(any) (bool, error)) ([]any, error) {
+	found, err := walk(v, segs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range found {
+		ok, err := cond(f)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return []any{v}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func compare(a any, op string, b any) (bool, error) {
+	switch op {
+	case "==":
+		return equal(a, b), nil
+
+	case "!=":
+		return !equal(a, b), nil
+	}
+
+	if a == nil {
+		return false, nil
+	}
+
+	c, err := utils.CompareScalars(a, b)
+	if err != nil {
+		return false, nil
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func equal(a, b any) bool {
+	if af, ok := utils.ToFloat(a); ok {
+		if bf, ok := utils.ToFloat(b); ok {
+			return af == bf
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// parsePath returns a list of path segments: string for a map key, int for
+// a list index, selector for a [key=value] match and nil for iteration.
+func parsePath(s string) ([]any, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("%s: path must start with . (%w)", s, errors.ErrInvalidQuery)
+	}
+
+	segs := []any{}
+	rest := s
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := indexUnquoted(rest, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("%s: unterminated [ (%w)", s, errors.ErrInvalidQuery)
+			}
+
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", s, err)
+			}
+
+			segs = append(segs, seg)
+			rest = rest[end+1:]
+
+		case strings.HasPrefix(rest, ".*"):
+			segs = append(segs, nil)
+			rest = rest[2:]
+
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := keysEnd(rest)
+
+			if end > 0 {
+				for _, key := range pathutil.SplitPath(rest[:end]) {
+					if key == "" {
+						return nil, fmt.Errorf("%s: empty key (%w)", s, errors.ErrInvalidQuery)
+					}
+
+					segs = append(segs, key)
+				}
+			} else if rest != "" && rest[0] == '.' {
+				return nil, fmt.Errorf("%s: empty key (%w)", s, errors.ErrInvalidQuery)
+			}
+
+			rest = rest[end:]
+
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q (%w)", s, rest, errors.ErrInvalidQuery)
+		}
+	}
+
+	return segs, nil
+}
+
+// keysEnd returns the length of the dotted keys at the start of s, which end
+// at a [ or at a . before [ or *. Escaped characters don't end them.
+func keysEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+
+		case s[i] == '[':
+			return i
+
+		case s[i] == '.' && i+1 < len(s) && (s[i+1] == '[' || s[i+1] == '*'):
+			return i
+		}
+	}
+
+	return len(s)
+}
+
+// parseBracket parses the inside of [...]: empty for iteration, an index, or
+// a quoted key or [key=value] selector as pathutil reads them.
+func parseBracket(s string) (any, error) {
+	s = strings.TrimSpace(s)
+
+	if s == "" {
+		return nil, nil
+	}
+
+	if i, err := strconv.Atoi(s); err == nil {
+		return i, nil
+	}
+
+	switch {
+	case strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'"):
+		// SplitPath leaves a bracket it can't read as it is
+		parts := pathutil.SplitPath("[" + s + "]")
+		if len(parts) != 1 || parts[0] == "["+s+"]" {
+			return nil, fmt.Errorf("[%s]: invalid quoted key (%w)", s, errors.ErrInvalidQuery)
+		}
+
+		return parts[0], nil
+
+	case indexUnquoted(s, "=") != -1:
+		return selector("[" + s + "]"), nil
+
+	default:
+		return nil, fmt.Errorf("%s: %w", s, errors.ErrInvalidIndex)
+	}
+}
+
+func walk(v any, segs []any) ([]any, error) {
+	if len(segs) == 0 {
+		return []any{v}, nil
+	}
+
+	switch seg := segs[0].(type) {
+	case nil:
+		vals, err := iterate(v)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := []any{}
+
+		for _, v2 := range vals {
+			r, err := walk(v2, segs[1:])
+			if err != nil {
+				return nil, err
+			}
+
+			ret = append(ret, r...)
+		}
+
+		return ret, nil
+
+	case string:
+		switch v2 := v.(type) {
+		case map[string]any:
+			return walk(v2[seg], segs[1:])
+
+		case nil:
+			return walk(nil, segs[1:])
+
+		default:
+			return nil, fmt.Errorf("cannot index %T with %q (%w)", v, seg, errors.ErrInvalidType)
+		}
+
+	case int:
+		switch v2 := v.(type) {
+		case []any:
+			i := seg
+			if i < 0 {
+				i += len(v2)
+			}
+
+			if i < 0 || i >= len(v2) {
+				return walk(nil, segs[1:])
+			}
+
+			return walk(v2[i], segs[1:])
+
+		case nil:
+			return walk(nil, segs[1:])
+
+		default:
+			return nil, fmt.Errorf("cannot index %T with %d (%w)", v, seg, errors.ErrInvalidType)
+		}
+
+	case selector:
+		switch v2 := v.(type) {
+		case []any:
+			entry, err := pathutil.Get(v2, []string{string(seg)})
+			if err != nil {
+				entry = nil
+			}
+
+			return walk(entry, segs[1:])
+
+		case nil:
+			return walk(nil, segs[1:])
+
+		default:
+			return nil, fmt.Errorf("cannot index %T with %s (%w)", v, seg, errors.ErrInvalidType)
+		}
+
+	default:
+		return nil, fmt.Errorf("%#v (%w)", seg, errors.ErrInvalidQuery)
+	}
+}
+
+func iterate(v any) ([]any, error) {
+	switch v2 := v.(type) {
+	case []any:
+		return v2, nil
+
+	case map[string]any:
+		ret := []any{}
+
+		for _, val := range utils.SortedMap(v2) {
+			ret = append(ret, val)
+		}
+
+		return ret, nil
+
+	case nil:
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("cannot iterate over %T (%w)", v, errors.ErrInvalidType)
+	}
+}
+
+// split splits s on sep, ignoring separators in quotes or parentheses.
+func split(s string, sep byte) ([]string, error) {
+	parts := []string{}
+	depth := 0
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+
+		case s[i] == '"':
+			quoted = !quoted
+
+		case quoted:
+
+		case s[i] == '(':
+			depth++
+
+		case s[i] == ')':
+			depth--
+
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	if quoted || depth != 0 {
+		return nil, fmt.Errorf("%s: unbalanced quotes or parentheses (%w)", s, errors.ErrInvalidQuery)
+	}
+
+	return append(parts, s[start:]), nil
+}
+
+// indexUnquoted returns the index of the first substr in s outside quotes.
+func indexUnquoted(s string, substr string) int {
+	quoted := false
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quoted && s[i] == '\\':
+			i++
+
+		case s[i] == '"':
+			quoted = !quoted
+
+		case !quoted && strings.HasPrefix(s[i:], substr):
+			return i
+		}
+	}
+
+	return -1
+}
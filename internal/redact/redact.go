@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/internal/utils"
+)
+
+// Placeholder returns the text that replaces s: [REDACTED:<sha256 prefix>],
+// so equal values can still be told apart.
+func Placeholder(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return fmt.Sprintf("[REDACTED:%s]", hex.EncodeToString(sum[:4]))
+}
+
+// Value returns a copy of v, a decoded document or part of one, with every
+// scalar replaced by its Placeholder. Nulls are left alone.
+func Value(v any) any {
+	switch v2 := v.(type) {
+	case map[string]any:
+		ret := make(map[string]any, len(v2))
+		for k, v3 := range v2 {
+			ret[k] = Value(v3)
+		}
+
+		return ret
+
+	case []any:
+		ret := make([]any, len(v2))
+		for i, v3 := range v2 {
+			ret[i] = Value(v3)
+		}
+
+		return ret
+
+	case nil:
+		return v
+
+	default:
+		return Placeholder(fmt.Sprint(v2))
+	}
+}
+
+// Paths returns a copy of doc with the values at paths (e.g. "db.password")
+// passed through Value.
+func Paths(doc any, paths []string) any {
+	doc, _ = utils.DeepClone(doc)
+
+	for _, path := range paths {
+		parts := pathutil.SplitPath(path)
+		if len(parts) == 0 {
+			continue
+		}
+
+		parent, err := pathutil.Get(doc, parts[:len(parts)-1])
+		if err != nil {
+			continue
+		}
+
+		last := parts[len(parts)-1]
+
+		switch parent2 := parent.(type) {
+		case map[string]any:
+			if v, found := parent2[last]; found {
+				parent2[last] = Value(v)
+			}
+
+		case []any:
+			if i, err := pathutil.ListIndex(parent2, last); err == nil {
+				parent2[i] = Value(parent2[i])
+			}
+		}
+	}
+
+	return doc
+}
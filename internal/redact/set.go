@@ -0,0 +1,227 @@
+package redact
+
+import (
+	"fmt"
+
+	"github.com/gopatchy/bkl/internal/pathutil"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// Set is the paths of the sensitive values in a document. Paths are made of
+// map keys only: list entries share their list's path, so marking a value in
+// a list marks the whole list.
+type Set struct {
+	marked   bool
+	children map[string]*Set
+}
+
+// Add marks the value at path and everything under it.
+func (s *Set) Add(path []string) {
+	s.node(path).marked = true
+}
+
+// Contains reports whether path or one of its parents is marked.
+func (s *Set) Contains(path []string) bool {
+	for _, k := range path {
+		if s == nil || s.marked {
+			return s != nil
+		}
+
+		s = s.children[k]
+	}
+
+	return s != nil && s.marked
+}
+
+// Sub returns a copy of the marks at and under path, or nil if there are
+// none. If a parent of path is marked, so is the whole copy.
+func (s *Set) Sub(path []string) *Set {
+	for _, k := range path {
+		if s == nil {
+			return nil
+		}
+
+		if s.marked {
+			return &Set{marked: true}
+		}
+
+		s = s.children[k]
+	}
+
+	// Nodes only exist on the way to a mark, so any node has one under it
+	return s.Clone()
+}
+
+// Graft adds the marks of sub, which may be nil, at path.
+func (s *Set) Graft(path []string, sub *Set) {
+	if sub == nil {
+		return
+	}
+
+	s.node(path).Merge(sub)
+}
+
+// Merge adds the marks of other, which may be nil, to s.
+func (s *Set) Merge(other *Set) {
+	if other == nil {
+		return
+	}
+
+	s.marked = s.marked || other.marked
+
+	for k, child := range other.children {
+		s.node([]string{k}).Merge(child)
+	}
+}
+
+// Clone returns a deep copy of s.
+func (s *Set) Clone() *Set {
+	if s == nil {
+		return nil
+	}
+
+	ret := &Set{}
+	ret.Merge(s)
+
+	return ret
+}
+
+// Apply returns doc with the marked values passed through Value. doc is
+// unchanged.
+func (s *Set) Apply(doc any) any {
+	if s == nil {
+		return doc
+	}
+
+	if s.marked {
+		return Value(doc)
+	}
+
+	switch doc2 := doc.(type) {
+	case map[string]any:
+		ret := make(map[string]any, len(doc2))
+		for k, v := range doc2 {
+			ret[k] = s.children[k].Apply(v)
+		}
+
+		return ret
+
+	case []any:
+		ret := make([]any, len(doc2))
+		for i, v := range doc2 {
+			ret[i] = s.Apply(v)
+		}
+
+		return ret
+
+	default:
+		return doc
+	}
+}
+
+func (s *Set) node(path []string) *Set {
+	for _, k := range path {
+		if s.children == nil {
+			s.children = map[string]*Set{}
+		}
+
+		child := s.children[k]
+		if child == nil {
+			child = &Set{}
+			s.children[k] = child
+		}
+
+		s = child
+	}
+
+	return s
+}
+
+// KeyPath returns the parts of a path into data that are map keys, which is
+// the form Set uses. Parts that index lists are dropped.
+func KeyPath(data any, parts []string) []string {
+	ret := []string{}
+
+	for _, part := range parts {
+		switch data2 := data.(type) {
+		case map[string]any:
+			ret = append(ret, part)
+			data = data2[part]
+
+		case []any:
+			i, err := pathutil.ListIndex(data2, part)
+			if err != nil {
+				return ret
+			}
+
+			data = data2[i]
+
+		default:
+			return ret
+		}
+	}
+
+	return ret
+}
+
+// Extract removes the $sensitive markers from doc, a layer that hasn't been
+// merged, and returns it with the paths they marked. A map that was only
+// {$sensitive: true, $value: x} becomes x.
+func Extract(doc any) (any, *Set, error) {
+	set := &Set{}
+
+	doc, err := extract(doc, set, []string{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, set, nil
+}
+
+func extract(doc any, set *Set, path []string) (any, error) {
+	switch doc2 := doc.(type) {
+	case map[string]any:
+		if v, found := doc2["$sensitive"]; found {
+			sensitive, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("$sensitive: %#v: %w", v, errors.ErrInvalidType)
+			}
+
+			delete(doc2, "$sensitive")
+
+			if sensitive {
+				set.Add(path)
+			}
+
+			if val, found := doc2["$value"]; found && len(doc2) == 1 {
+				return extract(val, set, path)
+			}
+		}
+
+		for k, v := range doc2 {
+			v2, err := extract(v, set, append(path, k))
+			if err != nil {
+				return nil, err
+			}
+
+			doc2[k] = v2
+		}
+
+		return doc2, nil
+
+	case []any:
+		for i, v := range doc2 {
+			v2, err := extract(v, set, path)
+			if err != nil {
+				return nil, err
+			}
+
+			doc2[i] = v2
+		}
+
+		return doc2, nil
+
+	default:
+		return doc, nil
+	}
+}
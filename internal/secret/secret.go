@@ -0,0 +1,283 @@
+// Package secret encrypts and decrypts values with local age or PGP keys.
+package secret
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// IsMethod reports whether name is a $decode method handled here.
+func IsMethod(name string) bool {
+	return name == "age" || name == "pgp"
+}
+
+// Keys returns the private key text for method from getenv: age identities
+// from BKL_AGE_KEY or the file named by BKL_AGE_KEY_FILE (falling back to
+// SOPS_AGE_KEY, SOPS_AGE_KEY_FILE and then SOPS's default keys.txt), or an
+// armored PGP secret key ring from BKL_PGP_KEY or BKL_PGP_KEY_FILE. Key
+// files are read from fsys, like input files.
+func Keys(fsys fs.FS, method string, getenv func(string) string) (string, error) {
+	var names []string
+
+	switch method {
+	case "age":
+		names = []string{"BKL_AGE_KEY", "SOPS_AGE_KEY"}
+
+	case "pgp":
+		names = []string{"BKL_PGP_KEY"}
+
+	default:
+		return "", fmt.Errorf("%s: %w", method, errors.ErrUnknownFormat)
+	}
+
+	for _, name := range names {
+		if key := getenv(name); key != "" {
+			return key, nil
+		}
+
+		if path := getenv(name + "_FILE"); path != "" {
+			key, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w: %w", name+"_FILE", err, errors.ErrMissingKey)
+			}
+
+			return string(key), nil
+		}
+	}
+
+	if method == "age" {
+		key, err := fs.ReadFile(fsys, sopsKeysFile(getenv))
+		if err == nil {
+			return string(key), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: set %s or %s_FILE: %w", method, names[0], names[0], errors.ErrMissingKey)
+}
+
+// sopsKeysFile returns where SOPS looks for age keys by default.
+func sopsKeysFile(getenv func(string) string) string {
+	dir := getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return ""
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "sops", "age", "keys.txt")
+}
+
+// Decrypt returns the plaintext of an armored age or PGP message, using the
+// private keys from fsys and getenv (see Keys).
+func Decrypt(fsys fs.FS, method string, ciphertext string, getenv func(string) string) (string, error) {
+	keys, err := Keys(fsys, method, getenv)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext = strings.TrimSpace(ciphertext)
+
+	var plain []byte
+
+	switch method {
+	case "age":
+		plain, err = decryptAge(ciphertext, keys)
+
+	case "pgp":
+		plain, err = decryptPGP(ciphertext, keys)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %w", method, err, errors.ErrDecrypt)
+	}
+
+	return string(plain), nil
+}
+
+// Encrypt returns plaintext as an armored age or PGP message for recipients:
+// age public keys (age1...) or armored PGP public key rings. If there are no
+// recipients, it encrypts to the private keys from fsys and getenv (see
+// Keys).
+func Encrypt(fsys fs.FS, method string, plaintext string, recipients []string, getenv func(string) string) (string, error) {
+	if !IsMethod(method) {
+		return "", fmt.Errorf("%s: %w", method, errors.ErrUnknownFormat)
+	}
+
+	keys := ""
+
+	if len(recipients) == 0 {
+		var err error
+
+		keys, err = Keys(fsys, method, getenv)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var ciphertext []byte
+	var err error
+
+	switch method {
+	case "age":
+		ciphertext, err = encryptAge(plaintext, recipients, keys)
+
+	case "pgp":
+		ciphertext, err = encryptPGP(plaintext, recipients, keys)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %w", method, err, errors.ErrEncrypt)
+	}
+
+	return string(ciphertext), nil
+}
+
+func decryptAge(ciphertext string, keys string) ([]byte, error) {
+	ids, err := age.ParseIdentities(strings.NewReader(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := age.Decrypt(agearmor.NewReader(strings.NewReader(ciphertext)), ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func encryptAge(plaintext string, recipients []string, keys string) ([]byte, error) {
+	rs := []age.Recipient{}
+
+	for _, recipient := range recipients {
+		r, err := age.ParseRecipients(strings.NewReader(recipient))
+		if err != nil {
+			return nil, err
+		}
+
+		rs = append(rs, r...)
+	}
+
+	if keys != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(keys))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			switch id2 := id.(type) {
+			case *age.X25519Identity:
+				rs = append(rs, id2.Recipient())
+
+			case *age.HybridIdentity:
+				rs = append(rs, id2.Recipient())
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	aw := agearmor.NewWriter(buf)
+
+	w, err := age.Encrypt(aw, rs...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(w, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = aw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decryptPGP(ciphertext string, keys string) ([]byte, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(keys))
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := pgparmor.Decode(strings.NewReader(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, keyring, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(md.UnverifiedBody)
+}
+
+func encryptPGP(plaintext string, recipients []string, keys string) ([]byte, error) {
+	entities := openpgp.EntityList{}
+
+	for _, keyring := range append(recipients, keys) {
+		if keyring == "" {
+			continue
+		}
+
+		el, err := openpgp.ReadArmoredKeyRing(strings.NewReader(keyring))
+		if err != nil {
+			return nil, err
+		}
+
+		entities = append(entities, el...)
+	}
+
+	buf := &bytes.Buffer{}
+
+	aw, err := pgparmor.Encode(buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := openpgp.Encrypt(aw, entities, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(w, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = aw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,397 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	agearmor "filippo.io/age/armor"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/gopatchy/bkl/internal/redact"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+var sopsValueRE = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// Prefix that SOPS hashes first when the MAC covers only encrypted values.
+var sopsMACOnlyEncryptedInit = []byte{0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0xb, 0xb, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69}
+
+type sopsMetadata struct {
+	Age []struct {
+		Enc string `yaml:"enc"`
+	} `yaml:"age"`
+	LastModified     string `yaml:"lastmodified"`
+	MAC              string `yaml:"mac"`
+	MACOnlyEncrypted bool   `yaml:"mac_only_encrypted"`
+}
+
+// IsSOPS reports whether a parsed document carries SOPS metadata.
+func IsSOPS(doc any) bool {
+	m, ok := doc.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	meta, ok := m["sops"].(map[string]any)
+	if !ok {
+		return false
+	}
+
+	_, found := meta["mac"]
+
+	return found
+}
+
+// DecryptSOPS returns a SOPS-encrypted YAML or JSON file as plain YAML, with
+// the sops metadata removed. The data key is unwrapped with the age
+// identities from fsys and getenv (see Keys) and the file's MAC is checked. It also
+// returns the paths of the decrypted values in each document, except those
+// under directive keys, to be treated as sensitive.
+func DecryptSOPS(fsys fs.FS, data []byte, getenv func(string) string) ([]byte, []*redact.Set, error) {
+	docs := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		node := &yaml.Node{}
+
+		err := dec.Decode(node)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", err, errors.ErrUnmarshal)
+		}
+
+		docs = append(docs, node)
+	}
+
+	if len(docs) == 0 || len(docs[0].Content) == 0 {
+		return nil, nil, fmt.Errorf("sops: missing metadata: %w", errors.ErrDecrypt)
+	}
+
+	metaNode := popSOPSMetadata(docs)
+	if metaNode == nil {
+		return nil, nil, fmt.Errorf("sops: missing metadata: %w", errors.ErrDecrypt)
+	}
+
+	meta := &sopsMetadata{}
+
+	err := metaNode.Decode(meta)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sops: %w: %w", err, errors.ErrDecrypt)
+	}
+
+	key, err := sopsDataKey(fsys, meta, getenv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s := &sopsTree{
+		key:     key,
+		macOnly: meta.MACOnlyEncrypted,
+		hash:    sha512.New(),
+	}
+
+	if s.macOnly {
+		s.hash.Write(sopsMACOnlyEncryptedInit)
+	}
+
+	decrypted := []*redact.Set{}
+
+	for _, doc := range docs {
+		s.decrypted = &redact.Set{}
+
+		err = s.walk(doc.Content[0], []string{})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		decrypted = append(decrypted, s.decrypted)
+	}
+
+	mac, err := sopsDecryptValue(meta.MAC, key, meta.LastModified)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sops: mac: %w: %w", err, errors.ErrDecrypt)
+	}
+
+	if mac.Value != fmt.Sprintf("%X", s.hash.Sum(nil)) {
+		return nil, nil, fmt.Errorf("sops: mac mismatch, file was modified without sops: %w", errors.ErrDecrypt)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+
+	for _, doc := range docs {
+		err = enc.Encode(doc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", err, errors.ErrMarshal)
+		}
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buf.Bytes(), decrypted, nil
+}
+
+// popSOPSMetadata removes the sops key from the root of every document and
+// returns its value from the first.
+func popSOPSMetadata(docs []*yaml.Node) *yaml.Node {
+	var ret *yaml.Node
+
+	for i, doc := range docs {
+		root := doc.Content[0]
+		if root.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for j := 0; j+1 < len(root.Content); j += 2 {
+			if root.Content[j].Value != "sops" {
+				continue
+			}
+
+			if i == 0 {
+				ret = root.Content[j+1]
+			}
+
+			root.Content = append(root.Content[:j], root.Content[j+2:]...)
+
+			break
+		}
+	}
+
+	return ret
+}
+
+func sopsDataKey(fsys fs.FS, meta *sopsMetadata, getenv func(string) string) ([]byte, error) {
+	if len(meta.Age) == 0 {
+		return nil, fmt.Errorf("sops: no age recipients (only age keys are supported): %w", errors.ErrMissingKey)
+	}
+
+	keys, err := Keys(fsys, "age", getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := age.ParseIdentities(strings.NewReader(keys))
+	if err != nil {
+		return nil, fmt.Errorf("sops: %w: %w", err, errors.ErrDecrypt)
+	}
+
+	for _, recipient := range meta.Age {
+		r, err := age.Decrypt(agearmor.NewReader(strings.NewReader(recipient.Enc)), ids...)
+		if err != nil {
+			continue
+		}
+
+		return io.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("sops: no age identity matches the file's recipients: %w", errors.ErrDecrypt)
+}
+
+type sopsTree struct {
+	key     []byte
+	macOnly bool
+	hash    hash.Hash
+
+	// decrypted is the paths of the values decrypted in the current document
+	decrypted *redact.Set
+}
+
+// walk decrypts the values under node in place and adds them to the MAC, in
+// the order SOPS does: document order, with map keys forming the path.
+func (s *sopsTree) walk(node *yaml.Node, path []string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			err := s.walk(node.Content[i+1], append(path, node.Content[i].Value))
+			if err != nil {
+				return err
+			}
+		}
+
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			err := s.walk(child, path)
+			if err != nil {
+				return err
+			}
+		}
+
+	case yaml.AliasNode:
+		return s.walk(node.Alias, path)
+
+	case yaml.ScalarNode:
+		return s.scalar(node, path)
+	}
+
+	return nil
+}
+
+func (s *sopsTree) scalar(node *yaml.Node, path []string) error {
+	if node.Tag != "!!str" || !sopsValueRE.MatchString(node.Value) {
+		if s.macOnly {
+			return nil
+		}
+
+		var v any
+
+		err := node.Decode(&v)
+		if err != nil {
+			return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+		}
+
+		switch v2 := v.(type) {
+		case nil:
+			return nil
+
+		case bool:
+			s.hashBool(v2)
+
+		case float64:
+			s.add(strconv.FormatFloat(v2, 'f', -1, 64))
+
+		case time.Time:
+			b, _ := v2.MarshalText()
+			s.add(string(b))
+
+		default:
+			s.add(fmt.Sprint(v2))
+		}
+
+		return nil
+	}
+
+	v, err := sopsDecryptValue(node.Value, s.key, strings.Join(path, ":")+":")
+	if err != nil {
+		return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+	}
+
+	node.Value = v.Value
+	node.Style = 0
+
+	if !slices.ContainsFunc(path, func(k string) bool { return strings.HasPrefix(k, "$") }) {
+		s.decrypted.Add(path)
+	}
+
+	switch v.Type {
+	case "int":
+		node.Tag = "!!int"
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+		}
+
+		s.add(strconv.Itoa(n))
+
+	case "float":
+		node.Tag = "!!float"
+		f, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+		}
+
+		s.add(strconv.FormatFloat(f, 'f', -1, 64))
+
+	case "bool":
+		node.Tag = "!!bool"
+		b, err := strconv.ParseBool(v.Value)
+		if err != nil {
+			return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+		}
+
+		node.Value = strconv.FormatBool(b)
+		s.hashBool(b)
+
+	case "time":
+		node.Tag = "!!timestamp"
+		t := time.Time{}
+		err := t.UnmarshalText([]byte(v.Value))
+		if err != nil {
+			return fmt.Errorf("sops: %s: %w: %w", strings.Join(path, "."), err, errors.ErrDecrypt)
+		}
+
+		b, _ := t.MarshalText()
+		s.add(string(b))
+
+	default:
+		node.Tag = "!!str"
+		s.add(v.Value)
+	}
+
+	return nil
+}
+
+func (s *sopsTree) hashBool(b bool) {
+	if b {
+		s.add("True")
+	} else {
+		s.add("False")
+	}
+}
+
+func (s *sopsTree) add(v string) {
+	s.hash.Write([]byte(v))
+}
+
+type sopsValue struct {
+	Value string
+	Type  string
+}
+
+// sopsDecryptValue decrypts one ENC[AES256_GCM,...] value. aad is the
+// value's path, joined and terminated with ":".
+func sopsDecryptValue(value string, key []byte, aad string) (*sopsValue, error) {
+	m := sopsValueRE.FindStringSubmatch(value)
+	if m == nil {
+		return nil, fmt.Errorf("%q is not a sops value", value)
+	}
+
+	parts := [][]byte{}
+
+	for _, s := range m[1:4] {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, b)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := gcm.Open(nil, parts[1], append(parts[0], parts[2]...), []byte(aad))
+	if err != nil {
+		return nil, err
+	}
+
+	return &sopsValue{
+		Value: string(plain),
+		Type:  m[4],
+	}, nil
+}
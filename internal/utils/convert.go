@@ -1,5 +1,7 @@
 package utils
 
+import "math/big"
+
 func ToBool(a any) (bool, bool) {
 	v, ok := a.(bool)
 	return v, ok
@@ -17,3 +19,48 @@ func ToInt(a any) (int, bool) {
 	v, ok := a.(int)
 	return v, ok
 }
+
+func ToFloat(a any) (float64, bool) {
+	switch v := a.(type) {
+	case int:
+		return float64(v), true
+
+	case int64:
+		return float64(v), true
+
+	case float64:
+		return v, true
+
+	case interface{ Float64() (float64, error) }:
+		f, err := v.Float64()
+		return f, err == nil
+
+	default:
+		return 0, false
+	}
+}
+
+// ToRat returns a number exactly, including one kept as its source text
+// because it doesn't fit in an int64 or float64.
+func ToRat(a any) (*big.Rat, bool) {
+	switch v := a.(type) {
+	case int:
+		return new(big.Rat).SetInt64(int64(v)), true
+
+	case int64:
+		return new(big.Rat).SetInt64(v), true
+
+	case float64:
+		r := new(big.Rat).SetFloat64(v)
+		return r, r != nil
+
+	case interface {
+		Float64() (float64, error)
+		String() string
+	}:
+		return new(big.Rat).SetString(v.String())
+
+	default:
+		return nil, false
+	}
+}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"cmp"
 	"fmt"
+	"reflect"
+	"slices"
 
 	"github.com/gopatchy/bkl/pkg/errors"
 )
@@ -107,3 +110,89 @@ func PopListMapBoolValue(l []any, k string, v bool) (bool, []any, error) {
 
 	return true, l, nil
 }
+
+// UniqueList returns l with repeated entries removed, keeping the first
+// occurrence of each. Entries are compared with Equal.
+func UniqueList(l []any) []any {
+	ret := []any{}
+
+	for _, v := range l {
+		if !slices.ContainsFunc(ret, func(v2 any) bool { return Equal(v, v2) }) {
+			ret = append(ret, v)
+		}
+	}
+
+	return ret
+}
+
+// Equal reports whether a and b are deeply equal, with numbers compared by
+// value, so 1, 1.0 and 1e0 are equal whichever type they were read as.
+func Equal(a, b any) bool {
+	if ar, ok := ToRat(a); ok {
+		br, ok := ToRat(b)
+		return ok && ar.Cmp(br) == 0
+	}
+
+	switch a2 := a.(type) {
+	case map[string]any:
+		b2, ok := b.(map[string]any)
+		if !ok || len(a2) != len(b2) {
+			return false
+		}
+
+		for k, v := range a2 {
+			v2, found := b2[k]
+			if !found || !Equal(v, v2) {
+				return false
+			}
+		}
+
+		return true
+
+	case []any:
+		b2, ok := b.([]any)
+		return ok && slices.EqualFunc(a2, b2, Equal)
+
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// SortList returns a sorted copy of a list of strings or a list of numbers.
+func SortList(l []any) ([]any, error) {
+	ret := slices.Clone(l)
+
+	var err error
+
+	slices.SortStableFunc(ret, func(a, b any) int {
+		c, err2 := CompareScalars(a, b)
+		if err2 != nil && err == nil {
+			err = err2
+		}
+
+		return c
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// CompareScalars orders two strings or two numbers.
+func CompareScalars(a, b any) (int, error) {
+	if af, ok := ToFloat(a); ok {
+		if bf, ok := ToFloat(b); ok {
+			return cmp.Compare(af, bf), nil
+		}
+	}
+
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return cmp.Compare(as, bs), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot compare %T and %T: %w", a, b, errors.ErrInvalidType)
+}
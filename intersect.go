@@ -13,6 +13,12 @@ import (
 )
 
 func Intersect(fx fs.FS, paths []string, rootPath string, workingDir string, selectors []string, format *string, formatPaths ...*string) ([]byte, error) {
+	return IntersectWithOptions(fx, paths, rootPath, workingDir, selectors, format, nil, formatPaths...)
+}
+
+// IntersectWithOptions is Intersect with Options for the output. If opts is
+// nil, it behaves like Intersect.
+func IntersectWithOptions(fx fs.FS, paths []string, rootPath string, workingDir string, selectors []string, format *string, opts *Options, formatPaths ...*string) ([]byte, error) {
 	preparedPaths, err := utils.PreparePathsForParser(paths, rootPath, workingDir)
 	if err != nil {
 		return nil, err
@@ -35,7 +41,7 @@ func Intersect(fx fs.FS, paths []string, rootPath string, workingDir string, sel
 			return nil, fmt.Errorf("file %s: %w", path, err)
 		}
 
-		fileObjs, err := file.LoadAndParents(fx2, realPath, nil)
+		fileObjs, err := file.LoadAndParents(fx2, realPath, nil, getOSEnv(), opts.format())
 		if err != nil {
 			return nil, fmt.Errorf("loading %s: %w", path, err)
 		}
@@ -49,10 +55,7 @@ func Intersect(fx fs.FS, paths []string, rootPath string, workingDir string, sel
 
 		if i == 0 {
 			for _, doc := range docs {
-				keyStr, err := evaluateSelectors(doc, selectors)
-				if err != nil {
-					return nil, fmt.Errorf("evaluating selectors on document in %s: %w", path, err)
-				}
+				keyStr := selectorKey(doc.Data, selectors)
 				if _, exists := tracking[keyStr]; exists {
 					return nil, fmt.Errorf("selector %q matches multiple documents in %s", keyStr, path)
 				}
@@ -62,10 +65,7 @@ func Intersect(fx fs.FS, paths []string, rootPath string, workingDir string, sel
 		} else {
 			seen := map[string]bool{}
 			for _, doc := range docs {
-				keyStr, err := evaluateSelectors(doc, selectors)
-				if err != nil {
-					return nil, fmt.Errorf("evaluating selectors on document in %s: %w", path, err)
-				}
+				keyStr := selectorKey(doc.Data, selectors)
 				if seen[keyStr] {
 					return nil, fmt.Errorf("selector %q matches multiple documents in %s", keyStr, path)
 				}
@@ -99,7 +99,7 @@ func Intersect(fx fs.FS, paths []string, rootPath string, workingDir string, sel
 		}
 	}
 
-	ft, err := determineFormat(format, formatPaths...)
+	ft, err := determineFormat(format, opts.format(), formatPaths...)
 	if err != nil {
 		return nil, err
 	}
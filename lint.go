@@ -0,0 +1,709 @@
+package bkl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/file"
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/process"
+	"github.com/gopatchy/bkl/internal/utils"
+	"go.yaml.in/yaml/v3"
+)
+
+// LintIssue is a problem found by Lint. Path is relative to the linted
+// directory, Key is the dotted path within the document and Line is 0 when
+// it isn't known.
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+type LintRule struct {
+	ID          string `json:"id"`
+	Description string `json:"description"`
+}
+
+var LintRules = []LintRule{
+	{"error", "File can't be loaded"},
+	{"useless-override", "Value is the same as the one inherited from the parent layers"},
+	{"useless-delete", "$delete of a key that no parent layer sets"},
+	{"unused-helper", "$output: false document that no $merge or $replace references"},
+	{"unresolved-env", "$env: reference to a variable that isn't set"},
+	{"unknown-directive", "String that looks like a directive but isn't one"},
+	{"unused-parent", "Layer that no leaf inherits from"},
+}
+
+// Directive names, for unknown-directive.
+var lintDirectives = []string{
+	"all", "any", "count", "decode", "defer", "delete", "encode", "env",
+	"exists", "file", "first", "glob", "gt", "in", "index", "insertAfter",
+	"insertBefore", "invert", "key", "last", "lt", "match", "matches",
+	"merge", "output", "parent", "path", "prepend", "regex", "repeat",
+	"replace", "required", "sensitive", "step", "type", "unique", "value",
+}
+
+var (
+	lintDirectiveRE = regexp.MustCompile(`^\$([a-z][a-zA-Z]*)`)
+	lintEnvRefRE    = regexp.MustCompile(`\{\$env:([^{}]+)\}`)
+)
+
+type linter struct {
+	fsys    *fsys.FS
+	dir     string
+	env     map[string]string
+	issues  []LintIssue
+	nodes   map[string][]*yaml.Node
+	files   map[string]*file.File
+	parents map[string]bool
+}
+
+// Lint checks the layer files under directory without evaluating them to
+// output, and returns the issues sorted by path and line. Leaves are the
+// files whose base name matches pattern or, if pattern is empty, the files
+// that no other file inherits from. If env is nil, the OS environment is
+// used for $env: references.
+func Lint(fx fs.FS, directory string, pattern string, env map[string]string) ([]LintIssue, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	l := &linter{
+		fsys:    fsys.New(fx),
+		dir:     "/" + strings.Trim(directory, "/"),
+		env:     env,
+		nodes:   map[string][]*yaml.Node{},
+		files:   map[string]*file.File{},
+		parents: map[string]bool{},
+	}
+
+	paths := []string{}
+
+	err := walkTree(fx, directory, "", func(path string, err error) {
+		if err != nil {
+			l.add("error", path, nil, 0, err.Error())
+			return
+		}
+
+		if _, err := format.Get(utils.Ext(path)); err == nil {
+			paths = append(paths, path)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chains := map[string][]*file.File{}
+
+	for _, path := range paths {
+		files, err := file.LoadAndParents(l.fsys, path, nil, env, nil)
+		if err != nil {
+			l.add("error", path, nil, 0, strings.TrimPrefix(err.Error(), path+": "))
+			continue
+		}
+
+		chains[path] = files
+		l.files[path] = files[len(files)-1]
+
+		for _, f := range files[:len(files)-1] {
+			l.parents[f.Path] = true
+		}
+	}
+
+	for _, path := range paths {
+		files, found := chains[path]
+		if !found {
+			continue
+		}
+
+		l.lintOverrides(files)
+	}
+
+	for _, path := range paths {
+		f, found := l.files[path]
+		if !found {
+			continue
+		}
+
+		for _, doc := range f.Docs {
+			l.lintStrings(f, doc, doc.Data, []string{})
+		}
+	}
+
+	l.lintHelpers(paths)
+	l.lintParents(paths, pattern, chains)
+
+	slices.SortStableFunc(l.issues, func(a, b LintIssue) int {
+		switch {
+		case a.Path != b.Path:
+			return strings.Compare(a.Path, b.Path)
+		case a.Line != b.Line:
+			return a.Line - b.Line
+		case a.Rule != b.Rule:
+			return strings.Compare(a.Rule, b.Rule)
+		default:
+			return strings.Compare(a.Key, b.Key)
+		}
+	})
+
+	return l.issues, nil
+}
+
+// lintOverrides merges the parents of the last file in files and compares
+// each of its documents with the parent documents it would merge into.
+func (l *linter) lintOverrides(files []*file.File) {
+	f := files[len(files)-1]
+
+	var docs []*document.Document
+
+	for _, parent := range files[:len(files)-1] {
+		var err error
+
+		docs, err = merge.FileObj(docs, parent)
+		if err != nil {
+			// Reported when linting the parent itself
+			return
+		}
+	}
+
+	for _, doc := range f.Docs {
+		targets, ok := lintTargets(docs, doc)
+		if !ok {
+			continue
+		}
+
+		data := []any{}
+		for _, target := range targets {
+			data = append(data, target.Data)
+		}
+
+		l.compare(f, doc, doc.Data, data, []string{})
+	}
+}
+
+// lintTargets returns the parent documents that doc merges into, or false
+// if that depends on more than a simple $match.
+func lintTargets(docs []*document.Document, doc *document.Document) ([]*document.Document, bool) {
+	m, ok := doc.Data.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	if _, found := m["$matches"]; found {
+		return nil, false
+	}
+
+	targets := []*document.Document{}
+
+	if pat, found := m["$match"]; found {
+		if pat == nil {
+			return targets, true
+		}
+
+		for _, d := range docs {
+			ok, err := process.MatchDoc(d, pat)
+			if err != nil {
+				return nil, false
+			}
+
+			if ok {
+				targets = append(targets, d)
+			}
+		}
+
+		return targets, true
+	}
+
+	parents := doc.AllParents()
+
+	for _, d := range docs {
+		if _, found := parents[d.ID]; found {
+			targets = append(targets, d)
+		}
+	}
+
+	return targets, true
+}
+
+// compare reports keys of child that are already set to the same value in
+// a parent and $delete of keys that no parent sets.
+func (l *linter) compare(f *file.File, doc *document.Document, child any, parents []any, path []string) {
+	m, ok := child.(map[string]any)
+	if !ok {
+		return
+	}
+
+	if _, found := m["$replace"]; found {
+		return
+	}
+
+	for k, v := range utils.SortedMap(m) {
+		if strings.HasPrefix(k, "$") {
+			continue
+		}
+
+		keyPath := append(slices.Clone(path), k)
+
+		pvs := []any{}
+
+		for _, parent := range parents {
+			pm, ok := parent.(map[string]any)
+			if !ok {
+				continue
+			}
+
+			if pv, found := pm[k]; found {
+				pvs = append(pvs, pv)
+			}
+		}
+
+		if v == "$delete" {
+			if len(pvs) == 0 {
+				l.add("useless-delete", f.Path, doc, 0, "$delete of a key that no parent sets", keyPath...)
+			}
+
+			continue
+		}
+
+		if slices.ContainsFunc(pvs, func(pv any) bool { return reflect.DeepEqual(v, pv) }) {
+			l.add("useless-override", f.Path, doc, 0, "same value as the parent layers", keyPath...)
+			continue
+		}
+
+		l.compare(f, doc, v, pvs, keyPath)
+	}
+}
+
+// lintStrings checks the keys and string values of obj for unknown
+// directives and unset $env: variables.
+func (l *linter) lintStrings(f *file.File, doc *document.Document, obj any, path []string) {
+	switch obj2 := obj.(type) {
+	case map[string]any:
+		for k, v := range utils.SortedMap(obj2) {
+			keyPath := append(slices.Clone(path), k)
+			l.lintString(f, doc, k, keyPath)
+			l.lintStrings(f, doc, v, keyPath)
+		}
+
+	case []any:
+		for i, v := range obj2 {
+			l.lintStrings(f, doc, v, append(slices.Clone(path), strconv.Itoa(i)))
+		}
+
+	case string:
+		l.lintString(f, doc, obj2, path)
+	}
+}
+
+func (l *linter) lintString(f *file.File, doc *document.Document, s string, path []string) {
+	if strings.HasPrefix(s, `$"`) && strings.HasSuffix(s, `"`) {
+		for _, m := range lintEnvRefRE.FindAllStringSubmatch(s, -1) {
+			l.lintEnv(f, doc, m[1], path)
+		}
+
+		return
+	}
+
+	if name, found := strings.CutPrefix(s, "$env:"); found {
+		l.lintEnv(f, doc, name, path)
+		return
+	}
+
+	m := lintDirectiveRE.FindStringSubmatch(s)
+	if m == nil || slices.Contains(lintDirectives, m[1]) {
+		return
+	}
+
+	msg := fmt.Sprintf("unknown directive $%s", m[1])
+
+	if suggestion := lintSuggest(m[1]); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean $%s?)", suggestion)
+	}
+
+	l.add("unknown-directive", f.Path, doc, 0, msg, path...)
+}
+
+func (l *linter) lintEnv(f *file.File, doc *document.Document, name string, path []string) {
+	if _, found := l.env[name]; found {
+		return
+	}
+
+	l.add("unresolved-env", f.Path, doc, 0, fmt.Sprintf("$env:%s is not set", name), path...)
+}
+
+// lintHelpers reports $output: false documents that no cross-document
+// $merge or $replace in the tree matches.
+func (l *linter) lintHelpers(paths []string) {
+	patterns := []any{}
+
+	for _, path := range paths {
+		f, found := l.files[path]
+		if !found {
+			continue
+		}
+
+		for _, doc := range f.Docs {
+			patterns = append(patterns, lintRefs(doc.Data)...)
+		}
+	}
+
+	for _, path := range paths {
+		f, found := l.files[path]
+		if !found {
+			continue
+		}
+
+		for _, doc := range f.Docs {
+			m, ok := doc.Data.(map[string]any)
+			if !ok || m["$output"] != false {
+				continue
+			}
+
+			used := slices.ContainsFunc(patterns, func(pat any) bool {
+				ok, err := process.MatchDoc(doc, pat)
+				return err == nil && ok
+			})
+
+			if !used {
+				l.add("unused-helper", f.Path, doc, 0, "$output: false document is never referenced by $merge or $replace")
+			}
+		}
+	}
+}
+
+// lintRefs returns the document patterns of the cross-document $merge and
+// $replace references in obj.
+func lintRefs(obj any) []any {
+	ret := []any{}
+
+	switch obj2 := obj.(type) {
+	case map[string]any:
+		for k, v := range obj2 {
+			if k == "$merge" || k == "$replace" {
+				switch ref := v.(type) {
+				case map[string]any:
+					if pat, found := ref["$match"]; found {
+						ret = append(ret, pat)
+					}
+
+				case []any:
+					if len(ref) > 0 {
+						switch ref[0].(type) {
+						case map[string]any, []any:
+							ret = append(ret, ref[0])
+						}
+					}
+				}
+			}
+
+			ret = append(ret, lintRefs(v)...)
+		}
+
+	case []any:
+		for _, v := range obj2 {
+			ret = append(ret, lintRefs(v)...)
+		}
+	}
+
+	return ret
+}
+
+// lintParents reports files that aren't leaves and aren't in any leaf's
+// chain of parents.
+func (l *linter) lintParents(paths []string, pattern string, chains map[string][]*file.File) {
+	used := map[string]bool{}
+
+	for _, path := range paths {
+		if !l.isLeaf(path, pattern) {
+			continue
+		}
+
+		for _, f := range chains[path] {
+			used[f.Path] = true
+		}
+	}
+
+	for _, path := range paths {
+		if _, found := l.files[path]; !found || used[path] {
+			continue
+		}
+
+		if pattern != "" {
+			l.add("unused-parent", path, nil, 0, fmt.Sprintf("no file matching %s inherits from it", pattern))
+		} else {
+			l.add("unused-parent", path, nil, 0, "every document is $output: false and no file inherits from it")
+		}
+	}
+}
+
+// isLeaf returns whether path matches pattern or, without a pattern, is
+// a file that nothing inherits from and that has output of its own.
+func (l *linter) isLeaf(path string, pattern string) bool {
+	if pattern != "" {
+		matched, err := filepath.Match(pattern, filepath.Base(path))
+		return err == nil && matched
+	}
+
+	f, found := l.files[path]
+	if !found || l.parents[path] {
+		return false
+	}
+
+	return len(f.Docs) == 0 || slices.ContainsFunc(f.Docs, func(doc *document.Document) bool {
+		m, ok := doc.Data.(map[string]any)
+		return !ok || m["$output"] != false
+	})
+}
+
+func (l *linter) add(rule string, path string, doc *document.Document, line int, msg string, key ...string) {
+	if doc != nil && line == 0 {
+		line = l.line(path, doc, key)
+	}
+
+	rel, err := filepath.Rel(l.dir, path)
+	if err != nil {
+		rel = path
+	}
+
+	l.issues = append(l.issues, LintIssue{
+		Rule:    rule,
+		Path:    rel,
+		Line:    line,
+		Key:     strings.Join(key, "."),
+		Message: msg,
+	})
+}
+
+// line returns the line of key in doc, for YAML and JSON files.
+func (l *linter) line(path string, doc *document.Document, key []string) int {
+	nodes, found := l.nodes[path]
+	if !found {
+		nodes = lintParseNodes(l.fsys, path)
+		l.nodes[path] = nodes
+	}
+
+	_, idx, found := strings.Cut(doc.ID[strings.LastIndex(doc.ID, "|"):], "|doc")
+	if !found {
+		return 0
+	}
+
+	n, err := strconv.Atoi(idx)
+	if err != nil || n >= len(nodes) {
+		return 0
+	}
+
+	node := nodes[n]
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for i, part := range key {
+		var next *yaml.Node
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == part {
+					// Point at the key for the last part
+					if i == len(key)-1 {
+						return node.Content[j].Line
+					}
+
+					next = node.Content[j+1]
+
+					break
+				}
+			}
+
+		case yaml.SequenceNode:
+			j, err := strconv.Atoi(part)
+			if err == nil && j < len(node.Content) {
+				next = node.Content[j]
+			}
+		}
+
+		if next == nil {
+			return node.Line
+		}
+
+		node = next
+	}
+
+	return node.Line
+}
+
+func lintParseNodes(fx *fsys.FS, path string) []*yaml.Node {
+	switch utils.Ext(path) {
+	case "yaml", "yml", "json":
+	default:
+		return nil
+	}
+
+	data, err := fs.ReadFile(fx, path)
+	if err != nil {
+		return nil
+	}
+
+	nodes := []*yaml.Node{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		node := &yaml.Node{}
+
+		err := dec.Decode(node)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nodes
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+// lintSuggest returns the directive closest to name, if it's close enough
+// to be a typo.
+func lintSuggest(name string) string {
+	best := ""
+	bestDist := 3
+
+	for _, d := range lintDirectives {
+		dist := levenshtein(name, d)
+		if dist < bestDist {
+			best = d
+			bestDist = dist
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
+
+// LintText formats issues one per line as path:line: rule: key: message.
+func LintText(issues []LintIssue) string {
+	buf := &strings.Builder{}
+
+	for _, issue := range issues {
+		buf.WriteString(issue.Path)
+
+		if issue.Line > 0 {
+			fmt.Fprintf(buf, ":%d", issue.Line)
+		}
+
+		fmt.Fprintf(buf, ": %s: ", issue.Rule)
+
+		if issue.Key != "" {
+			buf.WriteString(issue.Key + ": ")
+		}
+
+		buf.WriteString(issue.Message + "\n")
+	}
+
+	return buf.String()
+}
+
+// LintSARIF formats issues as a SARIF 2.1.0 log.
+func LintSARIF(issues []LintIssue) ([]byte, error) {
+	rules := []map[string]any{}
+	for _, rule := range LintRules {
+		rules = append(rules, map[string]any{
+			"id":               rule.ID,
+			"shortDescription": map[string]any{"text": rule.Description},
+		})
+	}
+
+	results := []map[string]any{}
+
+	for _, issue := range issues {
+		msg := issue.Message
+		if issue.Key != "" {
+			msg = issue.Key + ": " + msg
+		}
+
+		region := map[string]any{}
+		if issue.Line > 0 {
+			region["startLine"] = issue.Line
+		}
+
+		location := map[string]any{
+			"artifactLocation": map[string]any{"uri": filepath.ToSlash(issue.Path)},
+		}
+		if len(region) > 0 {
+			location["region"] = region
+		}
+
+		results = append(results, map[string]any{
+			"ruleId":    issue.Rule,
+			"level":     "warning",
+			"message":   map[string]any{"text": msg},
+			"locations": []any{map[string]any{"physicalLocation": location}},
+		})
+	}
+
+	log := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{
+			map[string]any{
+				"tool": map[string]any{
+					"driver": map[string]any{
+						"name":           "bkl",
+						"informationUri": "https://bkl.gopatchy.io/",
+						"rules":          rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+
+	out, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,292 @@
+package bkl_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type lspClient struct {
+	t      *testing.T
+	stdin  io.Writer
+	stdout *bufio.Reader
+	nextID int
+	diags  map[string][]map[string]any
+}
+
+func setupLSPServer(t *testing.T) (*exec.Cmd, *lspClient) {
+	cmd := exec.Command("go", "run", "./cmd/bkl-lsp/")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatalf("Failed to get stdin pipe: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to get stdout pipe: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	c := &lspClient{
+		t:      t,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		diags:  map[string][]map[string]any{},
+	}
+
+	c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	c.notify("initialized", map[string]any{})
+
+	return cmd, c
+}
+
+func (c *lspClient) send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatalf("Failed to marshal message: %v", err)
+	}
+
+	_, err = fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	if err != nil {
+		c.t.Fatalf("Failed to write message: %v", err)
+	}
+}
+
+func (c *lspClient) receive() map[string]any {
+	header, err := textproto.NewReader(c.stdout).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("Failed to read header: %v", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("Invalid Content-Length: %v", err)
+	}
+
+	body := make([]byte, length)
+
+	_, err = io.ReadFull(c.stdout, body)
+	if err != nil {
+		c.t.Fatalf("Failed to read body: %v", err)
+	}
+
+	msg := map[string]any{}
+
+	err = json.Unmarshal(body, &msg)
+	if err != nil {
+		c.t.Fatalf("Failed to unmarshal message: %v", err)
+	}
+
+	if msg["method"] == "textDocument/publishDiagnostics" {
+		params := msg["params"].(map[string]any)
+		diags := []map[string]any{}
+
+		for _, d := range params["diagnostics"].([]any) {
+			diags = append(diags, d.(map[string]any))
+		}
+
+		c.diags[params["uri"].(string)] = diags
+	}
+
+	return msg
+}
+
+func (c *lspClient) notify(method string, params any) {
+	c.send(map[string]any{"method": method, "params": params})
+}
+
+// request returns the result of a request, collecting diagnostics sent
+// before it.
+func (c *lspClient) request(method string, params any) any {
+	c.nextID++
+	c.send(map[string]any{"id": c.nextID, "method": method, "params": params})
+
+	for {
+		msg := c.receive()
+
+		id, ok := msg["id"].(float64)
+		if !ok || int(id) != c.nextID {
+			continue
+		}
+
+		if msg["error"] != nil {
+			c.t.Fatalf("%s: %v", method, msg["error"])
+		}
+
+		return msg["result"]
+	}
+}
+
+// sync waits until the server has handled every earlier notification.
+func (c *lspClient) sync() {
+	c.request("textDocument/hover", positionParams("file:///nonexistent.yaml", 0, 0))
+}
+
+func positionParams(uri string, line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func TestLSP(t *testing.T) {
+	t.Parallel()
+
+	dir := setupCLITestFiles(t, map[string]string{
+		"base.yaml":      "name: app\ndb:\n  host: localhost\n  port: 5432\n",
+		"base.prod.yaml": "db:\n  host: prod\n",
+		"common.yaml":    "name: common\n",
+		"other.yaml":     "$parent: common\nname: other\n",
+	})
+
+	cmd, c := setupLSPServer(t)
+	defer cmd.Process.Kill()
+
+	prodURI := "file://" + filepath.Join(dir, "base.prod.yaml")
+	otherURI := "file://" + filepath.Join(dir, "other.yaml")
+
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{
+			"uri":        prodURI,
+			"languageId": "yaml",
+			"version":    1,
+			"text":       "db:\n  host: prod\n",
+		},
+	})
+	c.sync()
+
+	if len(c.diags[prodURI]) != 0 {
+		t.Errorf("Expected no diagnostics, got %v", c.diags[prodURI])
+	}
+
+	t.Run("diagnostics", func(t *testing.T) {
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": prodURI, "version": 2},
+			"contentChanges": []any{map[string]any{"text": "db:\n  host: prod\n  user: $\"{missing}\"\n"}},
+		})
+		c.sync()
+
+		diags := c.diags[prodURI]
+		if len(diags) != 1 {
+			t.Fatalf("Expected 1 diagnostic, got %v", diags)
+		}
+
+		start := diags[0]["range"].(map[string]any)["start"].(map[string]any)
+		if start["line"] != float64(2) || start["character"] != float64(11) {
+			t.Errorf("Expected diagnostic at 2:11, got %v", start)
+		}
+
+		if !strings.Contains(diags[0]["message"].(string), "missing") {
+			t.Errorf("Unexpected message: %v", diags[0]["message"])
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": prodURI, "version": 3},
+			"contentChanges": []any{map[string]any{"text": "db:\n  host: prod\n\n"}},
+		})
+		c.sync()
+
+		if len(c.diags[prodURI]) != 0 {
+			t.Errorf("Expected diagnostics to clear, got %v", c.diags[prodURI])
+		}
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		result, ok := c.request("textDocument/hover", positionParams(prodURI, 1, 3)).(map[string]any)
+		if !ok {
+			t.Fatalf("Expected hover result")
+		}
+
+		value := result["contents"].(map[string]any)["value"].(string)
+
+		for _, want := range []string{"prod\n", "`base.yaml:3`", "`base.prod.yaml:2`"} {
+			if !strings.Contains(value, want) {
+				t.Errorf("Expected hover to contain %q, got:\n%s", want, value)
+			}
+		}
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		locs := c.request("textDocument/definition", positionParams(prodURI, 1, 3)).([]any)
+		if len(locs) != 1 {
+			t.Fatalf("Expected 1 location, got %v", locs)
+		}
+
+		loc := locs[0].(map[string]any)
+		if loc["uri"] != "file://"+filepath.Join(dir, "base.yaml") {
+			t.Errorf("Unexpected location: %v", loc)
+		}
+
+		start := loc["range"].(map[string]any)["start"].(map[string]any)
+		if start["line"] != float64(2) {
+			t.Errorf("Expected line 2, got %v", start)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": prodURI, "version": 4},
+			"contentChanges": []any{map[string]any{"text": "db:\n  host: prod\n  copy:\n    $merge: db.host\n  url: $\"{name}\"\n"}},
+		})
+
+		locs = c.request("textDocument/definition", positionParams(prodURI, 3, 14)).([]any)
+		if len(locs) != 1 || locs[0].(map[string]any)["uri"] != prodURI {
+			t.Errorf("Expected $merge to resolve to base.prod.yaml, got %v", locs)
+		}
+
+		locs = c.request("textDocument/definition", positionParams(prodURI, 4, 11)).([]any)
+		if len(locs) != 1 || locs[0].(map[string]any)["uri"] != "file://"+filepath.Join(dir, "base.yaml") {
+			t.Errorf("Expected {name} to resolve to base.yaml, got %v", locs)
+		}
+
+		c.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{
+				"uri":        otherURI,
+				"languageId": "yaml",
+				"version":    1,
+				"text":       "$parent: common\nname: other\n",
+			},
+		})
+
+		locs = c.request("textDocument/definition", positionParams(otherURI, 0, 11)).([]any)
+		if len(locs) != 1 || locs[0].(map[string]any)["uri"] != "file://"+filepath.Join(dir, "common.yaml") {
+			t.Errorf("Expected $parent to resolve to common.yaml, got %v", locs)
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		labels := func(line int, character int) map[string]bool {
+			ret := map[string]bool{}
+
+			for _, item := range c.request("textDocument/completion", positionParams(prodURI, line, character)).([]any) {
+				ret[item.(map[string]any)["label"].(string)] = true
+			}
+
+			return ret
+		}
+
+		top := labels(2, 0)
+		if !top["$merge"] || !top["name"] || top["port"] {
+			t.Errorf("Unexpected top-level completions: %v", top)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": prodURI, "version": 5},
+			"contentChanges": []any{map[string]any{"text": "db:\n  host: prod\n  \n"}},
+		})
+
+		db := labels(2, 2)
+		if !db["port"] || db["name"] {
+			t.Errorf("Unexpected db completions: %v", db)
+		}
+	})
+}
@@ -86,7 +86,22 @@ func runEvaluateTestMCP(ctx context.Context, client *mcp.Client, t *testing.T, e
 		args["sort"] = strings.Join(evaluate.Sort, ",")
 	}
 
-	callToolAndValidate(ctx, client, t, "evaluate", args, evaluate.Errors, evaluate.Result.Code, 0)
+	if evaluate.Options != nil {
+		args["formatOptions"] = evaluate.Options
+	}
+
+	tool := "evaluate"
+	if evaluate.Query != "" {
+		tool = "query_data"
+		args["query"] = evaluate.Query
+	}
+
+	expected := evaluate.Result.Code
+	if evaluate.Redacted != nil {
+		expected = evaluate.Redacted.Code
+	}
+
+	callToolAndValidate(ctx, client, t, tool, args, evaluate.Errors, expected, 0)
 }
 
 func runRequiredTestMCP(ctx context.Context, client *mcp.Client, t *testing.T, required *bkl.DocRequired) {
@@ -125,10 +140,24 @@ func runDiffTestMCP(ctx context.Context, client *mcp.Client, t *testing.T, diff
 	args["baseFile"] = diff.Base.Filename
 	args["targetFile"] = diff.Target.Filename
 
+	if len(diff.Bases) > 0 {
+		bases := []string{}
+		for _, base := range diff.Bases {
+			fileSystem[base.Filename] = base.Code
+			bases = append(bases, base.Filename)
+		}
+
+		args["baseLayers"] = strings.Join(bases, ",")
+	}
+
 	if len(diff.Selector) > 0 {
 		args["selectors"] = strings.Join(diff.Selector, ",")
 	}
 
+	if len(diff.Redact) > 0 {
+		args["redact"] = strings.Join(diff.Redact, ",")
+	}
+
 	callToolAndValidate(ctx, client, t, "diff", args, diff.Errors, diff.Result.Code, 0)
 }
 
@@ -150,6 +179,32 @@ func runCompareTestMCP(ctx context.Context, client *mcp.Client, t *testing.T, co
 		args["sort"] = strings.Join(compare.Sort, ",")
 	}
 
+	if len(compare.Redact) > 0 {
+		args["redact"] = strings.Join(compare.Redact, ",")
+	}
+
+	if len(compare.Selector) > 0 {
+		args["selectors"] = strings.Join(compare.Selector, ",")
+	}
+
+	if compare.Changes != "" {
+		args["report"] = compare.Changes
+
+		result, err := client.CallTool(ctx, "compare", args)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		output, err := extractField(result, "report")
+		if err != nil {
+			t.Fatalf("Failed to extract report: %v", err)
+		}
+
+		validateOutput(t, output, compare.Result.Code, 0)
+
+		return
+	}
+
 	callToolAndValidateDiff(ctx, client, t, "compare", args, compare.Result.Code)
 }
 
@@ -252,6 +307,11 @@ func TestMCP(t *testing.T) {
 			continue
 		}
 
+		// Skip schema inference, streaming, tag preservation and multi-file tests (not supported via MCP)
+		if testCase.Evaluate != nil && (testCase.Evaluate.InferSchema || testCase.Evaluate.Stream || testCase.Evaluate.OutputDir) {
+			continue
+		}
+
 		t.Run(testName, func(t *testing.T) {
 			switch {
 			case testCase.Evaluate != nil:
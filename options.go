@@ -0,0 +1,52 @@
+package bkl
+
+// Options are the settings taken by the *WithOptions functions and the
+// functions added alongside them. A nil *Options is the same as the zero
+// value: each format's default style and no redaction.
+type Options struct {
+	// Format sets how output is written. If nil, each format's default
+	// style is used.
+	Format *FormatOptions
+
+	// Redact makes EvaluateWithOptions, EvaluateTreeWithOptions and Query
+	// replace values marked $sensitive and decrypted values with
+	// placeholders, for output that's shown rather than used, like MCP
+	// responses. Compare and Diff always do.
+	Redact bool
+
+	// RedactPaths are paths (e.g. "db.password") whose values Compare and
+	// Diff also replace with placeholders.
+	RedactPaths []string
+
+	// Selectors are paths (e.g. "metadata.name") whose values pair up the
+	// documents that Compare compares, instead of their positions.
+	Selectors []string
+}
+
+func (o *Options) format() *FormatOptions {
+	if o == nil {
+		return nil
+	}
+
+	return o.Format
+}
+
+func (o *Options) redact() bool {
+	return o != nil && o.Redact
+}
+
+func (o *Options) redactPaths() []string {
+	if o == nil {
+		return nil
+	}
+
+	return o.RedactPaths
+}
+
+func (o *Options) selectors() []string {
+	if o == nil {
+		return nil
+	}
+
+	return o.Selectors
+}
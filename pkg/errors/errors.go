@@ -7,6 +7,9 @@ var (
 
 	ErrCircularRef       = fmt.Errorf("circular reference (%w)", Err)
 	ErrConflictingParent = fmt.Errorf("conflicting $parent (%w)", Err)
+	ErrDecrypt           = fmt.Errorf("decryption error (%w)", Err)
+	ErrDiffMismatch      = fmt.Errorf("diff doesn't reproduce the target (%w)", Err)
+	ErrEncrypt           = fmt.Errorf("encryption error (%w)", Err)
 	ErrExtraEntries      = fmt.Errorf("extra entries (%w)", Err)
 	ErrExtraKeys         = fmt.Errorf("extra keys (%w)", Err)
 	ErrInvalidArguments  = fmt.Errorf("invalid arguments (%w)", Err)
@@ -15,18 +18,24 @@ var (
 	ErrInvalidFilename   = fmt.Errorf("invalid filename (%w)", Err)
 	ErrInvalidInput      = fmt.Errorf("invalid input (%w)", Err)
 	ErrInvalidType       = fmt.Errorf("invalid type (%w)", Err)
+	ErrInvalidQuery      = fmt.Errorf("invalid query (%w)", Err)
 	ErrInvalidParent     = fmt.Errorf("invalid $parent (%w)", Err)
 	ErrInvalidRepeat     = fmt.Errorf("invalid $repeat (%w)", Err)
 	ErrMarshal           = fmt.Errorf("encoding error (%w)", Err)
 	ErrRefNotFound       = fmt.Errorf("reference not found (%w)", Err)
+	ErrRefactorMismatch  = fmt.Errorf("refactored layer changes the output (%w)", Err)
 	ErrMissingEnv        = fmt.Errorf("missing environment variable (%w)", Err)
 	ErrMissingFile       = fmt.Errorf("missing file (%w)", Err)
+	ErrMissingKey        = fmt.Errorf("missing decryption key (%w)", Err)
 	ErrMissingMatch      = fmt.Errorf("missing $match (%w)", Err)
 	ErrMultiMatch        = fmt.Errorf("multiple documents $match (%w)", Err)
+	ErrMultiInsertMatch  = fmt.Errorf("multiple entries matched $insertBefore/$insertAfter (%w)", Err)
 	ErrNoMatchFound      = fmt.Errorf("no document/entry matched $match (%w)", Err)
+	ErrNoInsertMatch     = fmt.Errorf("no entry matched $insertBefore/$insertAfter (%w)", Err)
 	ErrNoCloneFound      = fmt.Errorf("no document/entry matched $clone (%w)", Err)
 	ErrOutputFile        = fmt.Errorf("error opening output file (%w)", Err)
 	ErrRequiredField     = fmt.Errorf("required field not set (%w)", Err)
+	ErrStreamUnsupported = fmt.Errorf("not supported when streaming (%w)", Err)
 	ErrUnknownFormat     = fmt.Errorf("unknown format (%w)", Err)
 	ErrUnmarshal         = fmt.Errorf("decoding error (%w)", Err)
 	ErrUselessOverride   = fmt.Errorf("useless override (%w)", Err)
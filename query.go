@@ -0,0 +1,47 @@
+package bkl
+
+import (
+	"io/fs"
+
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/query"
+)
+
+// Query evaluates the specified files, runs a jq-style expression against the
+// list of output documents, and returns the formatted results, one document
+// per result. For example:
+//
+//	.[] | select(.kind == "Service") | .spec.ports
+//
+// If format is nil, it infers the format from the paths parameter (output path first, then input files).
+// If env is nil, it uses the current OS environment.
+// If opts is nil, it uses the format's default style and doesn't redact.
+// If sort is non-empty, documents are sorted by those paths before the query runs.
+func Query(fx fs.FS, files []string, rootPath string, workingDir string, env map[string]string, expr string, format *string, opts *Options, sort []string, paths ...*string) ([]byte, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	realFiles, inferredFormat, err := resolveFiles(fx, files, rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	allPaths := append(paths, &inferredFormat)
+	ft, err := determineFormat(format, opts.format(), allPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := merge.Outputs(fx, realFiles, env, &ft.Options, sort, opts.redact())
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := query.Run(expr, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return ft.MarshalValues(results)
+}
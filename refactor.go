@@ -0,0 +1,347 @@
+package bkl
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gopatchy/bkl/internal/canonical"
+	"github.com/gopatchy/bkl/internal/document"
+	"github.com/gopatchy/bkl/internal/file"
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/fsys"
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/utils"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+type RefactorFile struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content"`
+}
+
+// Refactor hoists what paths have in common into a new base layer at into,
+// and rewrites each of paths as a layer on top of it, using filename
+// inheritance if the names allow it and $parent if not. Before returning,
+// it checks that every rewritten file evaluates to exactly the same output
+// as before. It doesn't write anything; it returns the base followed by the
+// rewritten layers, with paths as passed in.
+func Refactor(fx fs.FS, paths []string, into string, rootPath string, workingDir string, selectors []string) ([]RefactorFile, error) {
+	if len(paths) < 2 {
+		return nil, fmt.Errorf("refactor requires at least 2 files, got %d", len(paths))
+	}
+
+	preparedPaths, err := utils.PreparePathsForParser(append(slices.Clone(paths), into), rootPath, workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	intoPath := preparedPaths[len(paths)]
+	preparedPaths = preparedPaths[:len(paths)]
+
+	if slices.Contains(preparedPaths, intoPath) {
+		return nil, fmt.Errorf("%s is one of the input files: %w", into, errors.ErrInvalidArguments)
+	}
+
+	if _, err := fs.Stat(fsys.New(fx), intoPath); err == nil {
+		return nil, fmt.Errorf("%s already exists: %w", into, errors.ErrInvalidArguments)
+	}
+
+	originals := [][]byte{}
+	inputs := []*refactorInput{}
+
+	for i, path := range preparedPaths {
+		orig, err := Evaluate(fx, []string{paths[i]}, rootPath, workingDir, nil, nil, nil, &paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("evaluating %s: %w", paths[i], err)
+		}
+
+		originals = append(originals, orig)
+
+		input, err := loadRefactorInput(fx, path, selectors)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	base, baseKeys, err := refactorBase(inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(baseKeys) == 0 {
+		return nil, fmt.Errorf("%s have nothing in common: %w", strings.Join(paths, ", "), errors.ErrInvalidInput)
+	}
+
+	baseDocs := []any{}
+	for _, key := range baseKeys {
+		baseDocs = append(baseDocs, base[key])
+	}
+
+	baseOut, err := refactorMarshal(baseDocs, intoPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", into, err)
+	}
+
+	ret := []RefactorFile{{Path: into, Content: baseOut}}
+	overlay := fsys.NewOverlay(fx, map[string][]byte{intoPath: baseOut})
+
+	for i, input := range inputs {
+		layer, err := refactorLayer(input, base, selectors)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent := refactorParent(preparedPaths[i], intoPath); parent != "" {
+			layer = refactorSetParent(layer, parent)
+		}
+
+		if len(layer) == 0 {
+			layer = append(layer, map[string]any{})
+		}
+
+		out, err := refactorMarshal(layer, preparedPaths[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+
+		ret = append(ret, RefactorFile{Path: paths[i], Content: out})
+		overlay.Files[preparedPaths[i]] = out
+	}
+
+	for i := range preparedPaths {
+		out, err := Evaluate(overlay, []string{paths[i]}, rootPath, workingDir, nil, nil, nil, &paths[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %w", paths[i], errors.ErrRefactorMismatch, err)
+		}
+
+		if !bytes.Equal(out, originals[i]) {
+			return nil, fmt.Errorf("%s: %w", paths[i], errors.ErrRefactorMismatch)
+		}
+	}
+
+	return ret, nil
+}
+
+// refactorInput is the merged documents of a file, keyed by selectors.
+type refactorInput struct {
+	path string
+	keys []string
+	docs map[string]any
+}
+
+func loadRefactorInput(fx fs.FS, path string, selectors []string) (*refactorInput, error) {
+	realPath, _, err := file.FileMatch(fx, path)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %w", path, err)
+	}
+
+	fileObjs, err := file.LoadAndParents(fsys.New(fx), realPath, nil, getOSEnv(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", path, err)
+	}
+
+	var docs []*document.Document
+
+	for _, f := range fileObjs {
+		docs, err = merge.FileObj(docs, f)
+		if err != nil {
+			return nil, fmt.Errorf("merging %s: %w", path, err)
+		}
+	}
+
+	input := &refactorInput{
+		path: path,
+		docs: map[string]any{},
+	}
+
+	for _, doc := range docs {
+		key := selectorKey(doc.Data, selectors)
+
+		if _, found := input.docs[key]; found {
+			return nil, fmt.Errorf("selector %q matches multiple documents in %s", key, path)
+		}
+
+		input.docs[key] = doc.Data
+		input.keys = append(input.keys, key)
+	}
+
+	return input, nil
+}
+
+// refactorBase returns the intersection of the inputs' documents, in the
+// order of the first input.
+func refactorBase(inputs []*refactorInput) (map[string]any, []string, error) {
+	base := map[string]any{}
+	keys := []string{}
+
+outer:
+	for _, key := range inputs[0].keys {
+		data := inputs[0].docs[key]
+		all := []any{data}
+
+		for _, input := range inputs[1:] {
+			other, found := input.docs[key]
+			if !found {
+				continue outer
+			}
+
+			result, include, err := intersect(data, other)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !include {
+				continue outer
+			}
+
+			data = result
+			all = append(all, other)
+		}
+
+		data, include := refactorPrefixLists(data, all)
+		if !include {
+			continue
+		}
+
+		base[key] = data
+		keys = append(keys, key)
+	}
+
+	return base, keys, nil
+}
+
+// refactorPrefixLists replaces the lists in base with the longest prefix
+// that the same list has in every input, since lists in the layers are
+// appended to them.
+func refactorPrefixLists(base any, inputs []any) (any, bool) {
+	switch base2 := base.(type) {
+	case map[string]any:
+		ret := map[string]any{}
+
+		for k, v := range base2 {
+			vs := []any{}
+			for _, input := range inputs {
+				vs = append(vs, input.(map[string]any)[k])
+			}
+
+			if v2, include := refactorPrefixLists(v, vs); include {
+				ret[k] = v2
+			}
+		}
+
+		return ret, len(ret) > 0
+
+	case []any:
+		prefix := inputs[0].([]any)
+
+		for _, input := range inputs[1:] {
+			list := input.([]any)
+
+			n := 0
+			for n < len(prefix) && n < len(list) && reflect.DeepEqual(prefix[n], list[n]) {
+				n++
+			}
+
+			prefix = prefix[:n]
+		}
+
+		return slices.Clone(prefix), len(prefix) > 0
+
+	default:
+		return base, true
+	}
+}
+
+// refactorLayer returns the documents that turn base into input.
+func refactorLayer(input *refactorInput, base map[string]any, selectors []string) ([]any, error) {
+	ret := []any{}
+
+	for _, key := range input.keys {
+		data := input.docs[key]
+
+		baseData, found := base[key]
+		if !found {
+			if m, ok := data.(map[string]any); ok {
+				m["$match"] = nil
+			}
+
+			ret = append(ret, data)
+
+			continue
+		}
+
+		result, err := diff(data, baseData)
+		if err != nil {
+			return nil, err
+		}
+
+		if result == nil {
+			continue
+		}
+
+		if len(selectors) > 0 {
+			result = addMatchDirective(result, buildMatchValue(data, selectors))
+		}
+
+		ret = append(ret, result)
+	}
+
+	return ret, nil
+}
+
+// refactorParent returns the $parent that path needs to inherit from base,
+// or "" if its filename already does.
+func refactorParent(path string, base string) string {
+	baseStem := strings.TrimSuffix(filepath.Base(base), filepath.Ext(base))
+	parts := strings.Split(filepath.Base(path), ".")
+
+	if filepath.Dir(path) == filepath.Dir(base) && len(parts) > 2 && strings.Join(parts[:len(parts)-2], ".") == baseStem {
+		return ""
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(path), filepath.Join(filepath.Dir(base), baseStem))
+	if err != nil {
+		return base
+	}
+
+	return rel
+}
+
+func refactorSetParent(docs []any, parent string) []any {
+	if len(docs) > 0 {
+		if m, ok := docs[0].(map[string]any); ok {
+			m["$parent"] = parent
+			return docs
+		}
+	}
+
+	return append([]any{map[string]any{"$parent": parent}}, docs...)
+}
+
+// refactorMarshal encodes docs in the format of path, in canonical form if
+// bkl fmt supports the format.
+func refactorMarshal(docs []any, path string) ([]byte, error) {
+	ft, err := format.Get(utils.Ext(path))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := ft.MarshalStream(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	formatted, err := canonical.Format(out, utils.Ext(path))
+	if err != nil {
+		return out, nil
+	}
+
+	return formatted, nil
+}
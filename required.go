@@ -16,6 +16,12 @@ import (
 // The file is loaded directly without processing, matching bklr behavior.
 // If format is nil, it infers the format from the paths parameter.
 func Required(fx fs.FS, path string, rootPath string, workingDir string, format *string, paths ...*string) ([]byte, error) {
+	return RequiredWithOptions(fx, path, rootPath, workingDir, format, nil, paths...)
+}
+
+// RequiredWithOptions is Required with Options for the output. If opts is
+// nil, it behaves like Required.
+func RequiredWithOptions(fx fs.FS, path string, rootPath string, workingDir string, format *string, opts *Options, paths ...*string) ([]byte, error) {
 	preparedPaths, err := utils.PreparePathsForParser([]string{path}, rootPath, workingDir)
 	if err != nil {
 		return nil, err
@@ -28,7 +34,7 @@ func Required(fx fs.FS, path string, rootPath string, workingDir string, format
 		return nil, fmt.Errorf("file %s: %w", path, err)
 	}
 
-	fileObjs, err := file.LoadAndParents(fsys.New(fx), realPath, nil)
+	fileObjs, err := file.LoadAndParents(fsys.New(fx), realPath, nil, getOSEnv(), opts.format())
 	if err != nil {
 		return nil, fmt.Errorf("loading %s: %w", path, err)
 	}
@@ -49,7 +55,7 @@ func Required(fx fs.FS, path string, rootPath string, workingDir string, format
 		results = append(results, result)
 	}
 
-	ft, err := determineFormat(format, paths...)
+	ft, err := determineFormat(format, opts.format(), paths...)
 	if err != nil {
 		return nil, err
 	}
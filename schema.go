@@ -0,0 +1,254 @@
+package bkl
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/gopatchy/bkl/internal/format"
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/internal/utils"
+)
+
+// maxEnum is the most distinct string values a key can have and still be
+// reported as an enum candidate.
+const maxEnum = 10
+
+// InferSchema evaluates every file under directory (like EvaluateTree) and
+// returns a JSON Schema describing the union of the output documents' shapes:
+// types, keys present in every instance of a map (required), and string
+// values that repeat across a small set (enum). Files that fail to evaluate
+// are left out; their errors are returned joined, with the schema of the
+// rest.
+// If format is nil, it infers the format from the paths parameter and falls
+// back to json-pretty.
+// If env is nil, it uses the current OS environment.
+// If opts is nil, it uses the format's default style.
+func InferSchema(fx fs.FS, directory string, pattern string, env map[string]string, format *string, opts *Options, paths ...*string) ([]byte, error) {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	root := &schemaNode{}
+	fileErrs := []error{}
+
+	err := walkTree(fx, directory, pattern, func(path string, err error) {
+		if err == nil {
+			err = inferFile(fx, path, env, opts.format(), root)
+		}
+
+		if err != nil {
+			fileErrs = append(fileErrs, fmt.Errorf("%s: %w", path, err))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	schema := root.schema()
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+
+	if format == nil || *format == "" {
+		jsonPretty := "json-pretty"
+		format = &jsonPretty
+
+		for _, path := range paths {
+			if path != nil && utils.Ext(*path) != "" {
+				format = nil
+				break
+			}
+		}
+	}
+
+	ft, err := determineFormat(format, opts.format(), paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := ft.MarshalStream([]any{schema})
+	if err != nil {
+		return nil, err
+	}
+
+	return output, errors.Join(fileErrs...)
+}
+
+func inferFile(fx fs.FS, path string, env map[string]string, opts *FormatOptions, root *schemaNode) error {
+	realFiles, _, err := resolveFiles(fx, []string{path}, "/", "/")
+	if err != nil {
+		return err
+	}
+
+	outputs, err := merge.Outputs(fx, realFiles, env, opts, nil, false)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range outputs {
+		root.add(doc)
+	}
+
+	return nil
+}
+
+type schemaNode struct {
+	types   map[string]bool
+	count   int
+	objects int
+	props   map[string]*schemaNode
+	items   *schemaNode
+	strings int
+	values  map[string]bool
+}
+
+func (n *schemaNode) add(v any) {
+	if n.types == nil {
+		n.types = map[string]bool{}
+		n.values = map[string]bool{}
+	}
+
+	n.count++
+
+	switch v2 := v.(type) {
+	case nil:
+		n.types["null"] = true
+
+	case bool:
+		n.types["boolean"] = true
+
+	case int, int64:
+		n.types["integer"] = true
+
+	case float64:
+		n.types["number"] = true
+
+	case format.Number:
+		if v2.IsInt() {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+
+	case string:
+		n.types["string"] = true
+		n.strings++
+
+		if n.values != nil {
+			n.values[v2] = true
+
+			if len(n.values) > maxEnum {
+				n.values = nil
+			}
+		}
+
+	case map[string]any:
+		n.types["object"] = true
+		n.objects++
+
+		if n.props == nil {
+			n.props = map[string]*schemaNode{}
+		}
+
+		for k, v3 := range v2 {
+			if n.props[k] == nil {
+				n.props[k] = &schemaNode{}
+			}
+
+			n.props[k].add(v3)
+		}
+
+	case []any:
+		n.types["array"] = true
+
+		if n.items == nil {
+			n.items = &schemaNode{}
+		}
+
+		for _, v3 := range v2 {
+			n.items.add(v3)
+		}
+
+	default:
+		n.types["string"] = true
+		n.values = nil
+	}
+}
+
+func (n *schemaNode) schema() map[string]any {
+	ret := map[string]any{}
+
+	if n.types["number"] {
+		delete(n.types, "integer")
+	}
+
+	types := []any{}
+	for t := range utils.SortedMap(n.types) {
+		types = append(types, t)
+	}
+
+	switch len(types) {
+	case 0:
+
+	case 1:
+		ret["type"] = types[0]
+
+	default:
+		ret["type"] = types
+	}
+
+	if n.props != nil {
+		props := map[string]any{}
+		required := []any{}
+
+		for k, child := range utils.SortedMap(n.props) {
+			props[k] = child.schema()
+
+			if child.count == n.objects {
+				required = append(required, k)
+			}
+		}
+
+		ret["properties"] = props
+
+		if len(required) > 0 {
+			ret["required"] = required
+		}
+	}
+
+	if n.items != nil && n.items.count > 0 {
+		ret["items"] = n.items.schema()
+	}
+
+	if n.isEnum() {
+		enum := []any{}
+
+		for v := range utils.SortedMap(n.values) {
+			enum = append(enum, v)
+		}
+
+		if n.types["null"] {
+			enum = append(enum, nil)
+		}
+
+		ret["enum"] = enum
+	}
+
+	return ret
+}
+
+// isEnum reports whether all non-null values are strings drawn from a small
+// set that repeats, which suggests a closed set rather than free text.
+func (n *schemaNode) isEnum() bool {
+	if n.values == nil || n.strings <= len(n.values) {
+		return false
+	}
+
+	for t := range n.types {
+		if !slices.Contains([]string{"string", "null"}, t) {
+			return false
+		}
+	}
+
+	return true
+}
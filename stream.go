@@ -0,0 +1,43 @@
+package bkl
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/gopatchy/bkl/internal/merge"
+	"github.com/gopatchy/bkl/pkg/errors"
+)
+
+// EvaluateStream processes the specified files like Evaluate, but reads,
+// merges and writes the documents of the last file one at a time, so memory
+// use doesn't grow with its size. The output matches Evaluate; inputs where
+// it couldn't, such as a streamed document patching parent layers (found by
+// filename only) after other streamed documents were written, are errors, as
+// are $parent and $defer. Only YAML and JSON can be streamed.
+// If format is nil, it infers the format from the paths parameter (output path first, then input files).
+// If env is nil, it uses the current OS environment.
+// If opts is nil, it uses the format's default style.
+func EvaluateStream(fx fs.FS, files []string, rootPath string, workingDir string, env map[string]string, format *string, opts *Options, w io.Writer, paths ...*string) error {
+	if env == nil {
+		env = getOSEnv()
+	}
+
+	realFiles, inferredFormat, err := resolveFiles(fx, files, rootPath, workingDir)
+	if err != nil {
+		return err
+	}
+
+	allPaths := append(paths, &inferredFormat)
+	ft, err := determineFormat(format, opts.format(), allPaths...)
+	if err != nil {
+		return err
+	}
+
+	enc := ft.NewEncoder(w)
+	if enc == nil {
+		return fmt.Errorf("output format: %w", errors.ErrStreamUnsupported)
+	}
+
+	return merge.Stream(fx, realFiles, env, &ft.Options, enc)
+}